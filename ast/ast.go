@@ -3,11 +3,14 @@ package ast
 import (
 	"bytes"
 	"galexw/monkey/token"
+	"math/big"
+	"strings"
 )
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position // Position of the node's token in the source
 }
 
 type Statement interface {
@@ -22,6 +25,7 @@ type Expression interface {
 
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // only filled in when the lexer keeps comments
 }
 
 // Still figuring out what this is trying to do
@@ -34,6 +38,13 @@ func (p *Program) TokenLiteral() string {
 	}
 }
 
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{}
+}
+
 func (p *Program) String() string {
 	var out bytes.Buffer
 	for _, s := range p.Statements {
@@ -50,6 +61,7 @@ type LetStatement struct {
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
+func (ls *LetStatement) Pos() token.Position  { return ls.Token.Position }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
@@ -69,17 +81,40 @@ type Identifier struct {
 
 func (i *Identifier) expressionNode()      {}
 func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
+func (i *Identifier) Pos() token.Position  { return i.Token.Position }
 func (i *Identifier) String() string       { return i.Value }
 
 type IntegerLiteral struct {
 	Token token.Token
 	Value int64
+	Big   *big.Int // set instead of Value when the literal doesn't fit an int64
 }
 
 func (i *IntegerLiteral) expressionNode()      {}
 func (i *IntegerLiteral) TokenLiteral() string { return i.Token.Literal }
+func (i *IntegerLiteral) Pos() token.Position  { return i.Token.Position }
 func (i *IntegerLiteral) String() string       { return i.Token.Literal }
 
+type FloatLiteral struct {
+	Token token.Token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode()      {}
+func (fl *FloatLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FloatLiteral) Pos() token.Position  { return fl.Token.Position }
+func (fl *FloatLiteral) String() string       { return fl.Token.Literal }
+
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) Pos() token.Position  { return sl.Token.Position }
+func (sl *StringLiteral) String() string       { return sl.Token.Literal }
+
 type Boolean struct {
 	Token token.Token
 	Value bool
@@ -87,6 +122,7 @@ type Boolean struct {
 
 func (i *Boolean) expressionNode()      {}
 func (i *Boolean) TokenLiteral() string { return i.Token.Literal }
+func (i *Boolean) Pos() token.Position  { return i.Token.Position }
 func (i *Boolean) String() string       { return i.Token.Literal }
 
 // <prefix><expression>
@@ -98,6 +134,7 @@ type PrefixExpression struct {
 
 func (p *PrefixExpression) expressionNode()      {}
 func (p *PrefixExpression) TokenLiteral() string { return p.Token.Literal }
+func (p *PrefixExpression) Pos() token.Position  { return p.Token.Position }
 func (p *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -117,6 +154,7 @@ type InfixExpression struct {
 
 func (i *InfixExpression) expressionNode()      {}
 func (i *InfixExpression) TokenLiteral() string { return i.Token.Literal }
+func (i *InfixExpression) Pos() token.Position  { return i.Token.Position }
 func (i *InfixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
@@ -136,6 +174,7 @@ type IfExpression struct {
 
 func (i *IfExpression) expressionNode()      {}
 func (i *IfExpression) TokenLiteral() string { return i.Token.Literal }
+func (i *IfExpression) Pos() token.Position  { return i.Token.Position }
 func (i *IfExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("if")
@@ -156,6 +195,7 @@ type Block struct {
 
 func (i *Block) statementNode()       {}
 func (i *Block) TokenLiteral() string { return i.Token.Literal }
+func (i *Block) Pos() token.Position  { return i.Token.Position }
 func (i *Block) String() string {
 	var out bytes.Buffer
 	for _, s := range i.Statements {
@@ -168,10 +208,12 @@ type FunctionLiteral struct {
 	Token      token.Token
 	Parameters []*Identifier
 	Body       *Block
+	Name       string // Set when the function is bound with let, so it can call itself
 }
 
 func (fe *FunctionLiteral) expressionNode()      {}
 func (fe *FunctionLiteral) TokenLiteral() string { return fe.Token.Literal }
+func (fe *FunctionLiteral) Pos() token.Position  { return fe.Token.Position }
 func (fe *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	out.WriteString("fn")
@@ -195,6 +237,7 @@ type ReturnStatement struct {
 
 func (i *ReturnStatement) statementNode()       {}
 func (i *ReturnStatement) TokenLiteral() string { return i.Token.Literal }
+func (i *ReturnStatement) Pos() token.Position  { return i.Token.Position }
 func (i *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(i.TokenLiteral() + " ")
@@ -214,6 +257,7 @@ type ExpressionStatement struct {
 
 func (i *ExpressionStatement) statementNode()       {}
 func (i *ExpressionStatement) TokenLiteral() string { return i.Token.Literal }
+func (i *ExpressionStatement) Pos() token.Position  { return i.Token.Position }
 func (i *ExpressionStatement) String() string {
 	return i.Expression.String() + ";"
 }
@@ -226,6 +270,7 @@ type CallExpression struct {
 
 func (i *CallExpression) expressionNode()      {}
 func (i *CallExpression) TokenLiteral() string { return i.Token.Literal }
+func (i *CallExpression) Pos() token.Position  { return i.Token.Position }
 func (i *CallExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString(i.Function.String())
@@ -239,3 +284,83 @@ func (i *CallExpression) String() string {
 	out.WriteString(")")
 	return out.String()
 }
+
+type ArrayLiteral struct {
+	Token    token.Token // The [ token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() token.Position  { return al.Token.Position }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+// <expression>[<expression>]
+type IndexExpression struct {
+	Token token.Token // The [ token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() token.Position  { return ie.Token.Position }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+	return out.String()
+}
+
+type HashLiteral struct {
+	Token token.Token // The { token
+	Pairs []HashPair  // in source order, which is the order they are evaluated in
+}
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() token.Position  { return hl.Token.Position }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// Comment is a // or /* */ comment. Comments aren't part of any statement,
+// they are collected on the Program in source order so tools can put them
+// back next to the nodes around them
+type Comment struct {
+	Token token.Token // The COMMENT token, its literal includes the delimiters
+}
+
+func (c *Comment) TokenLiteral() string { return c.Token.Literal }
+func (c *Comment) Pos() token.Position  { return c.Token.Position }
+func (c *Comment) String() string       { return c.Token.Literal }
@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"bytes"
 	"galexw/monkey/token"
 	"testing"
 )
@@ -26,3 +27,65 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. Got %q", program.String())
 	}
 }
+
+func TestDump(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Position: token.Position{Line: 1, Column: 1}},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENTIFIER, Literal: "x", Position: token.Position{Line: 1, Column: 5}},
+					Value: "x",
+				},
+				Value: &PrefixExpression{
+					Token:    token.Token{Type: token.MINUS, Literal: "-", Position: token.Position{Line: 1, Column: 9}},
+					Operator: "-",
+					RightExpression: &IntegerLiteral{
+						Token: token.Token{Type: token.INT, Literal: "5", Position: token.Position{Line: 1, Column: 10}},
+						Value: 5,
+					},
+				},
+			},
+			&ExpressionStatement{
+				Token: token.Token{Type: token.IF, Literal: "if", Position: token.Position{Line: 2, Column: 1}},
+				Expression: &IfExpression{
+					Token: token.Token{Type: token.IF, Literal: "if", Position: token.Position{Line: 2, Column: 1}},
+					Condition: &Boolean{
+						Token: token.Token{Type: token.TRUE, Literal: "true", Position: token.Position{Line: 2, Column: 5}},
+						Value: true,
+					},
+					Consequence: &Block{
+						Token: token.Token{Type: token.LEFTBRACE, Literal: "{", Position: token.Position{Line: 2, Column: 11}},
+					},
+				},
+			},
+		},
+	}
+
+	expected := `Program 1:1
+  Statements:
+    LetStatement 1:1
+      Name: Identifier 1:5
+        Value: "x"
+      Value: PrefixExpression 1:9
+        Operator: "-"
+        RightExpression: IntegerLiteral 1:10
+          Value: 5
+          Big: nil
+    ExpressionStatement 2:1
+      Expression: IfExpression 2:1
+        Condition: Boolean 2:5
+          Value: true
+        Consequence: Block 2:11
+          Statements: []
+        Alternative: nil
+  Comments: []
+`
+
+	var out bytes.Buffer
+	Dump(&out, program)
+
+	if out.String() != expected {
+		t.Errorf("Dump wrong.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,92 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Dump writes node as an indented tree, one node per line with its type and
+// position, followed by its fields. It walks the structs with reflection so
+// new node types show up without having to be taught to it
+func Dump(w io.Writer, node Node) {
+	d := &dumper{w: w}
+	d.node("", node, 0)
+}
+
+type dumper struct {
+	w io.Writer
+}
+
+func (d *dumper) line(depth int, format string, args ...interface{}) {
+	fmt.Fprintf(d.w, "%s%s\n", strings.Repeat("  ", depth), fmt.Sprintf(format, args...))
+}
+
+func (d *dumper) node(label string, node Node, depth int) {
+	v := reflect.ValueOf(node)
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		d.line(depth, "%snil", label)
+		return
+	}
+
+	d.line(depth, "%s%s %s", label, v.Elem().Type().Name(), node.Pos())
+
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Name == "Token" || !field.IsExported() {
+			continue
+		}
+		d.field(field.Name+": ", v.Field(i), depth+1)
+	}
+}
+
+func (d *dumper) field(label string, v reflect.Value, depth int) {
+	if node, ok := asNode(v); ok {
+		d.node(label, node, depth)
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		// A nil Expression or Statement
+		d.line(depth, "%snil", label)
+	case reflect.Pointer:
+		if v.IsNil() {
+			d.line(depth, "%snil", label)
+			return
+		}
+		d.line(depth, "%s%v", label, v.Interface())
+	case reflect.Slice:
+		if v.Len() == 0 {
+			d.line(depth, "%s[]", label)
+			return
+		}
+		d.line(depth, "%s", strings.TrimSuffix(label, " "))
+		for i := 0; i < v.Len(); i++ {
+			d.field("", v.Index(i), depth+1)
+		}
+	case reflect.Struct:
+		// A part of a node that isn't a node itself, like a hash pair
+		d.line(depth, "%s%s", label, v.Type().Name())
+		for i := 0; i < v.NumField(); i++ {
+			d.field(v.Type().Field(i).Name+": ", v.Field(i), depth+1)
+		}
+	case reflect.String:
+		d.line(depth, "%s%q", label, v.String())
+	default:
+		d.line(depth, "%s%v", label, v.Interface())
+	}
+}
+
+func asNode(v reflect.Value) (Node, bool) {
+	if !v.CanInterface() {
+		return nil, false
+	}
+	if v.Kind() == reflect.Interface && v.IsNil() {
+		return nil, false
+	}
+	node, ok := v.Interface().(Node)
+	return node, ok
+}
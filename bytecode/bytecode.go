@@ -0,0 +1,319 @@
+// Package bytecode reads and writes compiled Monkey programs.
+//
+// A file is laid out as, with every number in big endian:
+//
+//	magic       "MNKY"
+//	version     uint16
+//	filename    the source file the program was built from, may be empty
+//	constants   uint32 count, then per constant a one byte tag and its value
+//	globals     uint32 count, then the name of each global
+//	main        instructions and line table of the top level program
+//
+// Instructions and names are a uint32 length and the raw bytes. A line table
+// is a uint32 count of (offset, line, column) uint32 triples. A function
+// constant is its uint32 local and parameter counts, its instructions and
+// line table, then a uint32 count and the name of each local and of each
+// free variable.
+//
+// Decode checks the instructions against the rest of the file, so a
+// damaged or hand made file is rejected instead of crashing the VM.
+package bytecode
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"galexw/monkey/code"
+	"galexw/monkey/compiler"
+	"galexw/monkey/object"
+	"io"
+	"math"
+	"math/big"
+)
+
+// Version is bumped whenever the format or the instruction set changes, so
+// old files are rejected instead of being run with the wrong opcodes
+const Version uint16 = 9
+
+var magic = []byte("MNKY")
+
+// Constant tags
+const (
+	tagInteger    byte = 1
+	tagString     byte = 2
+	tagFunction   byte = 3
+	tagFloat      byte = 4
+	tagBigInteger byte = 5 // stored as its decimal text
+)
+
+var ErrNotBytecode = errors.New("not a monkey bytecode file")
+
+// VersionError is returned by Decode for files written by another version
+type VersionError struct {
+	Version uint16
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("bytecode version %d is not supported, expected version %d; rebuild the file with this monkey", e.Version, Version)
+}
+
+func Encode(w io.Writer, bc *compiler.Bytecode) error {
+	e := &encoder{w: bufio.NewWriter(w)}
+
+	e.bytes(magic)
+	e.uint16(Version)
+	e.string(bc.Filename)
+
+	e.uint32(uint32(len(bc.Constants)))
+	for _, c := range bc.Constants {
+		e.constant(c)
+	}
+
+	e.names(bc.Globals)
+
+	e.instructions(bc.Instructions)
+	e.lines(bc.Lines)
+
+	if e.err != nil {
+		return e.err
+	}
+	return e.w.Flush()
+}
+
+func Decode(r io.Reader) (*compiler.Bytecode, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	d := &decoder{data: data}
+
+	header := d.bytes(len(magic))
+	if d.err != nil || !bytes.Equal(header, magic) {
+		return nil, ErrNotBytecode
+	}
+
+	if version := d.uint16(); d.err == nil && version != Version {
+		return nil, &VersionError{Version: version}
+	}
+
+	bc := &compiler.Bytecode{}
+	bc.Filename = d.string()
+
+	count := d.uint32()
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		bc.Constants = append(bc.Constants, d.constant())
+	}
+
+	bc.Globals = d.names()
+
+	bc.Instructions = d.instructions()
+	bc.Lines = d.lines()
+
+	if d.err == nil {
+		d.err = validate(bc)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("corrupt bytecode file: %w", d.err)
+	}
+	return bc, nil
+}
+
+// encoder remembers the first write error so the encoding code can be
+// written without checking every call
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (e *encoder) bytes(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) uint16(v uint16) {
+	e.bytes(binary.BigEndian.AppendUint16(nil, v))
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.bytes(binary.BigEndian.AppendUint32(nil, v))
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.bytes(binary.BigEndian.AppendUint64(nil, v))
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.bytes([]byte(s))
+}
+
+func (e *encoder) names(names []string) {
+	e.uint32(uint32(len(names)))
+	for _, name := range names {
+		e.string(name)
+	}
+}
+
+func (e *encoder) constant(obj object.Object) {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		e.bytes([]byte{tagInteger})
+		e.uint64(uint64(obj.Value))
+	case *object.BigInteger:
+		e.bytes([]byte{tagBigInteger})
+		e.string(obj.Value.String())
+	case *object.Float:
+		e.bytes([]byte{tagFloat})
+		e.uint64(math.Float64bits(obj.Value))
+	case *object.String:
+		e.bytes([]byte{tagString})
+		e.string(obj.Value)
+	case *object.CompiledFunction:
+		e.bytes([]byte{tagFunction})
+		e.uint32(uint32(obj.NumLocals))
+		e.uint32(uint32(obj.NumParameters))
+		e.instructions(obj.Instructions)
+		e.lines(obj.Lines)
+		e.names(obj.LocalNames)
+		e.names(obj.FreeNames)
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("cannot encode constant of type %s", obj.Type())
+		}
+	}
+}
+
+func (e *encoder) instructions(ins code.Instructions) {
+	e.uint32(uint32(len(ins)))
+	e.bytes(ins)
+}
+
+func (e *encoder) lines(lt code.LineTable) {
+	e.uint32(uint32(len(lt)))
+	for _, entry := range lt {
+		e.uint32(uint32(entry.Offset))
+		e.uint32(uint32(entry.Line))
+		e.uint32(uint32(entry.Column))
+	}
+}
+
+// decoder is the reading counterpart of encoder, over the whole file. Once
+// err is set every read returns zero values
+type decoder struct {
+	data []byte // what is left to read
+	err  error
+}
+
+// bytes reads the next n bytes. The lengths in a file are checked against
+// what is left of it before anything is allocated for them
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+
+	b := d.data[:n:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if b := d.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint64() uint64 {
+	if b := d.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes(int(d.uint32())))
+}
+
+func (d *decoder) names() []string {
+	count := d.uint32()
+
+	var names []string
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		names = append(names, d.string())
+	}
+	return names
+}
+
+func (d *decoder) constant() object.Object {
+	switch tag := d.byte(); tag {
+	case tagInteger:
+		return &object.Integer{Value: int64(d.uint64())}
+	case tagBigInteger:
+		text := d.string()
+		value, ok := new(big.Int).SetString(text, 10)
+		if !ok {
+			if d.err == nil {
+				d.err = fmt.Errorf("invalid big integer constant %q", text)
+			}
+			return nil
+		}
+		return &object.BigInteger{Value: value}
+	case tagFloat:
+		return &object.Float{Value: math.Float64frombits(d.uint64())}
+	case tagString:
+		return &object.String{Value: d.string()}
+	case tagFunction:
+		fn := &object.CompiledFunction{}
+		fn.NumLocals = int(d.uint32())
+		fn.NumParameters = int(d.uint32())
+		fn.Instructions = d.instructions()
+		fn.Lines = d.lines()
+		fn.LocalNames = d.names()
+		fn.FreeNames = d.names()
+		return fn
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown constant tag %d", tag)
+		}
+		return nil
+	}
+}
+
+func (d *decoder) instructions() code.Instructions {
+	return d.bytes(int(d.uint32()))
+}
+
+func (d *decoder) lines() code.LineTable {
+	count := d.uint32()
+
+	var lt code.LineTable
+	for i := uint32(0); i < count && d.err == nil; i++ {
+		lt = append(lt, code.LineEntry{
+			Offset: int(d.uint32()),
+			Line:   int(d.uint32()),
+			Column: int(d.uint32()),
+		})
+	}
+	return lt
+}
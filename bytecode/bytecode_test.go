@@ -0,0 +1,232 @@
+package bytecode
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"galexw/monkey/code"
+	"galexw/monkey/compiler"
+	"galexw/monkey/lexer"
+	"galexw/monkey/object"
+	"galexw/monkey/parser"
+	"galexw/monkey/vm"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func compile(t *testing.T, input string) *compiler.Bytecode {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("parser error: %s", err)
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return comp.Bytecode()
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "3"},
+		{`"mon" + "key"`, "monkey"},
+		{"-5", "-5"},
+		{"1.5 * 2", "3.0"},
+		{"99999999999999999999 + 1", "100000000000000000000"},
+		{"let add = fn(a, b) { a + b }; add(1, 2)", "3"},
+		{`let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+fib(10)`, "55"},
+		{"let adder = fn(x) { fn(y) { x + y } }; adder(2)(3)", "5"},
+		{`{"a": [1, 2, 3]}["a"][1]`, "2"},
+	}
+
+	for _, tt := range tests {
+		bc := compile(t, tt.input)
+
+		var buf bytes.Buffer
+		if err := Encode(&buf, bc); err != nil {
+			t.Fatalf("Encode(%q) error: %s", tt.input, err)
+		}
+
+		decoded, err := Decode(&buf)
+		if err != nil {
+			t.Fatalf("Decode(%q) error: %s", tt.input, err)
+		}
+
+		if !reflect.DeepEqual(decoded, bc) {
+			t.Errorf("decoded bytecode differs for %q.\nwant=%#v\ngot =%#v", tt.input, bc, decoded)
+		}
+
+		machine := vm.New(decoded)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error for %q: %s", tt.input, err)
+		}
+		if got := machine.LastPoppedStackElem().Inspect(); got != tt.expected {
+			t.Errorf("wrong result for %q. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	var valid bytes.Buffer
+	if err := Encode(&valid, compile(t, `let f = fn(x) { x }; f("a")`)); err != nil {
+		t.Fatalf("Encode error: %s", err)
+	}
+
+	if _, err := Decode(bytes.NewReader([]byte("let x = 1;"))); !errors.Is(err, ErrNotBytecode) {
+		t.Errorf("source file: expected ErrNotBytecode, got %v", err)
+	}
+
+	if _, err := Decode(bytes.NewReader(nil)); !errors.Is(err, ErrNotBytecode) {
+		t.Errorf("empty file: expected ErrNotBytecode, got %v", err)
+	}
+
+	old := append([]byte{}, valid.Bytes()...)
+	binary.BigEndian.PutUint16(old[len(magic):], Version+1)
+	_, err := Decode(bytes.NewReader(old))
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("expected *VersionError, got %v", err)
+	}
+	if versionErr.Version != Version+1 {
+		t.Errorf("wrong version in error. want=%d, got=%d", Version+1, versionErr.Version)
+	}
+
+	truncated := valid.Bytes()[:valid.Len()-3]
+	if _, err := Decode(bytes.NewReader(truncated)); err == nil {
+		t.Errorf("expected an error for a truncated file")
+	}
+
+	// A length far past the end of the file fails without allocating it
+	huge := append([]byte{}, magic...)
+	huge = binary.BigEndian.AppendUint16(huge, Version)
+	huge = binary.BigEndian.AppendUint32(huge, 0xffffffff)
+	if _, err := Decode(bytes.NewReader(huge)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("huge length: expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestDecodeInvalidInstructions(t *testing.T) {
+	fn := func(numLocals int, ins ...[]byte) *object.CompiledFunction {
+		return &object.CompiledFunction{Instructions: concat(ins...), NumLocals: numLocals}
+	}
+
+	tests := []struct {
+		bytecode *compiler.Bytecode
+		expected string
+	}{
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpConstant, 1)},
+			"main: at 0000: constant 1 out of range",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Instructions{255}},
+			"main: at 0000: opcode 255 undefined",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpConstant, 0)[:2]},
+			"main: at 0000: OpConstant is cut off",
+		},
+		{
+			&compiler.Bytecode{Instructions: concat(code.Make(code.OpJump, 2), code.Make(code.OpNull))},
+			"main: at 0000: jump to 0002 is not an instruction",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpGetLocal, 0)},
+			"main: at 0000: local 0 out of range",
+		},
+		{
+			&compiler.Bytecode{Instructions: code.Make(code.OpGetBuiltin, 200)},
+			"main: at 0000: builtin 200 out of range",
+		},
+		{
+			&compiler.Bytecode{
+				Instructions: code.Make(code.OpClosure, 0, 0),
+				Constants:    []object.Object{&object.Integer{Value: 1}},
+			},
+			"main: at 0000: constant 0 is not a function",
+		},
+		{
+			&compiler.Bytecode{Constants: []object.Object{fn(1, code.Make(code.OpGetLocal, 1))}},
+			"function 0: at 0000: local 1 out of range",
+		},
+		{
+			&compiler.Bytecode{Constants: []object.Object{fn(1000)}},
+			"function 0: 0 parameters and 1000 locals",
+		},
+	}
+
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := Encode(&buf, tt.bytecode); err != nil {
+			t.Fatalf("Encode error: %s", err)
+		}
+
+		_, err := Decode(&buf)
+		if err == nil {
+			t.Errorf("expected an error for %q", tt.expected)
+			continue
+		}
+		if !strings.HasSuffix(err.Error(), tt.expected) {
+			t.Errorf("wrong error. want suffix=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestDecodeFilename(t *testing.T) {
+	p := parser.New(lexer.NewFile("prog.mk", "let x = 1;\nx + \"a\""))
+	program, err := p.ParseProgram()
+	if err != nil {
+		t.Fatalf("parser error: %s", err)
+	}
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, comp.Bytecode()); err != nil {
+		t.Fatalf("Encode error: %s", err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode error: %s", err)
+	}
+	if decoded.Filename != "prog.mk" {
+		t.Errorf("wrong filename. want=%q, got=%q", "prog.mk", decoded.Filename)
+	}
+
+	err = vm.New(decoded).Run()
+	var rerr *vm.RuntimeError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected *vm.RuntimeError, got %v", err)
+	}
+	if got := rerr.Position.String(); got != "prog.mk:2:3" {
+		t.Errorf("wrong error position. want=%q, got=%q", "prog.mk:2:3", got)
+	}
+}
+
+func concat(ins ...[]byte) code.Instructions {
+	out := code.Instructions{}
+	for _, i := range ins {
+		out = append(out, i...)
+	}
+	return out
+}
+
+func TestEncodeUnsupportedConstant(t *testing.T) {
+	bc := &compiler.Bytecode{Constants: []object.Object{&object.Boolean{Value: true}}}
+
+	if err := Encode(&bytes.Buffer{}, bc); err == nil {
+		t.Errorf("expected an error encoding a boolean constant")
+	}
+}
@@ -0,0 +1,99 @@
+package bytecode
+
+import (
+	"fmt"
+	"galexw/monkey/code"
+	"galexw/monkey/compiler"
+	"galexw/monkey/object"
+)
+
+// validate checks that every instruction in bc decodes, and that its
+// operands point at constants, locals, free variables, builtins and jump
+// targets that exist, so the VM never indexes past them
+func validate(bc *compiler.Bytecode) error {
+	if err := validateInstructions(bc.Instructions, 0, 0, bc.Constants); err != nil {
+		return fmt.Errorf("main: %w", err)
+	}
+
+	for i, c := range bc.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		if fn.NumParameters > fn.NumLocals || fn.NumLocals > 256 {
+			return fmt.Errorf("function %d: %d parameters and %d locals", i, fn.NumParameters, fn.NumLocals)
+		}
+		if err := validateInstructions(fn.Instructions, fn.NumLocals, len(fn.FreeNames), bc.Constants); err != nil {
+			return fmt.Errorf("function %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func validateInstructions(ins code.Instructions, numLocals, numFree int, constants []object.Object) error {
+	// Jumps have to land on the start of an instruction, or right after
+	// the last one
+	starts := map[int]bool{len(ins): true}
+	var jumps []int
+
+	for i := 0; i < len(ins); {
+		starts[i] = true
+
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			return fmt.Errorf("at %04d: %w", i, err)
+		}
+
+		width := 0
+		for _, w := range def.OperandWidths {
+			width += w
+		}
+		if i+1+width > len(ins) {
+			return fmt.Errorf("at %04d: %s is cut off", i, def.Name)
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		switch op := code.Opcode(ins[i]); op {
+		case code.OpConstant:
+			if operands[0] >= len(constants) {
+				return fmt.Errorf("at %04d: constant %d out of range", i, operands[0])
+			}
+		case code.OpClosure:
+			if operands[0] >= len(constants) {
+				return fmt.Errorf("at %04d: constant %d out of range", i, operands[0])
+			}
+			fn, ok := constants[operands[0]].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("at %04d: constant %d is not a function", i, operands[0])
+			}
+			if operands[1] != len(fn.FreeNames) {
+				return fmt.Errorf("at %04d: function takes %d free variables, not %d", i, len(fn.FreeNames), operands[1])
+			}
+		case code.OpGetLocal, code.OpSetLocal, code.OpCaptureLocal:
+			if operands[0] >= numLocals {
+				return fmt.Errorf("at %04d: local %d out of range", i, operands[0])
+			}
+		case code.OpGetFree, code.OpCaptureFree:
+			if operands[0] >= numFree {
+				return fmt.Errorf("at %04d: free variable %d out of range", i, operands[0])
+			}
+		case code.OpGetBuiltin:
+			if operands[0] >= len(object.Builtins) {
+				return fmt.Errorf("at %04d: builtin %d out of range", i, operands[0])
+			}
+		case code.OpJump, code.OpJumpNotTruthy, code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop:
+			jumps = append(jumps, i)
+		}
+
+		i += 1 + read
+	}
+
+	for _, i := range jumps {
+		if target := int(code.ReadUint16(ins[i+1:])); !starts[target] {
+			return fmt.Errorf("at %04d: jump to %04d is not an instruction", i, target)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package compiler
+
+import (
+	"fmt"
+	"galexw/monkey/code"
+	"galexw/monkey/object"
+	"io"
+)
+
+// Disassemble writes a readable listing of bc: the main program, then every
+// compiled function in the constant pool. Each instruction is shown with its
+// offset and source position, and operands that refer to something (a
+// constant, a variable, a builtin) are annotated with what they refer to
+func Disassemble(w io.Writer, bc *Bytecode) {
+	d := &disassembler{w: w, constants: bc.Constants, globals: bc.Globals}
+
+	fmt.Fprintln(w, "== main ==")
+	d.instructions(bc.Instructions, bc.Lines)
+
+	if len(bc.Constants) > 0 {
+		fmt.Fprintln(w, "\n== constants ==")
+		for i := range bc.Constants {
+			fmt.Fprintf(w, "%04d %s\n", i, d.constant(i))
+		}
+	}
+
+	for i, c := range bc.Constants {
+		fn, ok := c.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "\n== constant %d: function, %s, %s ==\n", i,
+			count(fn.NumParameters, "parameter"), count(fn.NumLocals, "local"))
+		d.locals, d.free = fn.LocalNames, fn.FreeNames
+		d.instructions(fn.Instructions, fn.Lines)
+	}
+}
+
+type disassembler struct {
+	w         io.Writer
+	constants []object.Object
+
+	// Variable names by index. locals and free are those of the function
+	// being listed
+	globals, locals, free []string
+}
+
+func (d *disassembler) instructions(ins code.Instructions, lines code.LineTable) {
+	i := 0
+	for i < len(ins) {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(d.w, "%04d ERROR: %s\n", i, err)
+			i++
+			continue
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		pos := "-"
+		if entry, ok := lines.Lookup(i); ok {
+			pos = fmt.Sprintf("%d:%d", entry.Line, entry.Column)
+		}
+
+		text := def.Name
+		for _, operand := range operands {
+			text += fmt.Sprintf(" %d", operand)
+		}
+
+		if comment := d.comment(code.Opcode(ins[i]), operands); comment != "" {
+			fmt.Fprintf(d.w, "%04d %-7s %-22s ; %s\n", i, pos, text, comment)
+		} else {
+			fmt.Fprintf(d.w, "%04d %-7s %s\n", i, pos, text)
+		}
+
+		i += 1 + read
+	}
+}
+
+// comment describes what the operands of an instruction refer to
+func (d *disassembler) comment(op code.Opcode, operands []int) string {
+	switch op {
+	case code.OpConstant:
+		return d.constant(operands[0])
+	case code.OpClosure:
+		return fmt.Sprintf("%s, %d free", d.constant(operands[0]), operands[1])
+	case code.OpGetGlobal, code.OpSetGlobal:
+		return name(d.globals, operands[0])
+	case code.OpGetLocal, code.OpSetLocal, code.OpCaptureLocal:
+		return name(d.locals, operands[0])
+	case code.OpGetFree, code.OpCaptureFree:
+		return name(d.free, operands[0])
+	case code.OpGetBuiltin:
+		if operands[0] < len(object.Builtins) {
+			return object.Builtins[operands[0]].Name
+		}
+	case code.OpJump, code.OpJumpNotTruthy, code.OpJumpNotTruthyOrPop, code.OpJumpTruthyOrPop:
+		return fmt.Sprintf("to %04d", operands[0])
+	case code.OpCall:
+		return count(operands[0], "argument")
+	case code.OpArray:
+		return count(operands[0], "element")
+	case code.OpHash:
+		return count(operands[0]/2, "pair")
+	}
+	return ""
+}
+
+// name returns names[index], or nothing when the bytecode has no name for it
+func name(names []string, index int) string {
+	if index < len(names) {
+		return names[index]
+	}
+	return ""
+}
+
+// count formats n with noun, made plural unless n is 1
+func count(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func (d *disassembler) constant(index int) string {
+	if index >= len(d.constants) {
+		return fmt.Sprintf("constant %d out of range", index)
+	}
+
+	switch c := d.constants[index].(type) {
+	case *object.CompiledFunction:
+		return fmt.Sprintf("function %d", index)
+	case *object.String:
+		return fmt.Sprintf("%q", c.Value)
+	default:
+		return c.Inspect()
+	}
+}
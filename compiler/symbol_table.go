@@ -0,0 +1,190 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope   SymbolScope = "GLOBAL"
+	LocalScope    SymbolScope = "LOCAL"
+	BuiltinScope  SymbolScope = "BUILTIN"
+	FreeScope     SymbolScope = "FREE"
+	FunctionScope SymbolScope = "FUNCTION"
+)
+
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable maps names to the slots they live in. Every function gets its
+// own table, and every block inside it gets a block table that shadows names
+// but hands out slots from the function's table, since a block doesn't get a
+// frame of its own
+type SymbolTable struct {
+	Outer       *SymbolTable
+	FreeSymbols []Symbol // symbols from enclosing functions captured by this one
+
+	store          map[string]Symbol
+	numDefinitions int
+	slotNames      []string     // the name each slot was defined for, by index
+	owner          *SymbolTable // the table slots are allocated from
+
+	// Functions look names up when they run in the evaluator, so a
+	// function can use a let that comes after it in an enclosing block.
+	// pending counts the lets of the block being compiled that haven't been
+	// defined yet, and forward holds the slots handed out early for them
+	pending map[string]int
+	forward map[string]Symbol
+}
+
+func NewSymbolTable() *SymbolTable {
+	s := &SymbolTable{store: make(map[string]Symbol), forward: make(map[string]Symbol)}
+	s.owner = s
+	return s
+}
+
+// NewEnclosedSymbolTable creates the table for a function defined in outer
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// NewBlockSymbolTable creates the table for a block nested in outer
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	s.owner = outer.owner
+	return s
+}
+
+// NumDefinitions is how many slots the function (or the globals) needs,
+// including the ones used by its blocks
+func (s *SymbolTable) NumDefinitions() int {
+	return s.owner.numDefinitions
+}
+
+// Declare records the names bound by the lets of the block about to be
+// compiled in this table, so functions in the block can refer to the ones
+// defined after them
+func (s *SymbolTable) Declare(names []string) {
+	s.pending = make(map[string]int)
+	for _, name := range names {
+		s.pending[name]++
+	}
+}
+
+// Define binds name in this table. Binding a name that is already bound
+// here reuses its slot, the same way the evaluator overwrites it in place
+func (s *SymbolTable) Define(name string) Symbol {
+	if s.pending[name] > 0 {
+		s.pending[name]--
+	}
+
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
+
+	symbol, ok := s.forward[name]
+	if ok {
+		delete(s.forward, name)
+	} else {
+		symbol = s.allocate(name)
+	}
+
+	s.store[name] = symbol
+	return symbol
+}
+
+// allocate hands out the next slot of the function (or the globals)
+func (s *SymbolTable) allocate(name string) Symbol {
+	symbol := Symbol{Name: name, Index: s.owner.numDefinitions}
+	if s.owner.Outer == nil {
+		symbol.Scope = GlobalScope
+	} else {
+		symbol.Scope = LocalScope
+	}
+
+	s.owner.numDefinitions++
+	s.owner.slotNames = append(s.owner.slotNames, name)
+	return symbol
+}
+
+// IsFinal reports whether name is a local of this table that no later let
+// in the block rebinds, so its value never changes once it is defined
+func (s *SymbolTable) IsFinal(name string) bool {
+	symbol, ok := s.store[name]
+	return ok && symbol.Scope == LocalScope && s.pending[name] == 0
+}
+
+// DefineGlobal binds name in the global table, for names used before they
+// are defined, like a function calling one that is defined after it. The
+// VM reports the name as not found if nothing has set it by the time the
+// use runs, which is when the evaluator would report it too
+func (s *SymbolTable) DefineGlobal(name string) Symbol {
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s.Define(name)
+}
+
+// SlotNames returns the names of the slots handed out by the function (or
+// the globals) this table belongs to, by index, for error messages
+func (s *SymbolTable) SlotNames() []string {
+	return s.owner.slotNames
+}
+
+func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
+	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+// DefineFunctionName binds the name of the function being compiled, so it
+// can refer to itself without capturing itself as a free variable
+func (s *SymbolTable) DefineFunctionName(name string) Symbol {
+	symbol := Symbol{Name: name, Index: 0, Scope: FunctionScope}
+	s.store[name] = symbol
+	return symbol
+}
+
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	return s.resolve(name, false)
+}
+
+// resolve looks name up from a function nested in this table's function
+// when nested is set. Such a function only runs once the block it is in has
+// moved on, so it also sees the lets of the block that come after it
+func (s *SymbolTable) resolve(name string, nested bool) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if !ok && nested {
+		symbol, ok = s.forward[name]
+		if !ok && s.pending[name] > 0 {
+			symbol, ok = s.allocate(name), true
+			s.forward[name] = symbol
+		}
+	}
+	if ok || s.Outer == nil {
+		return symbol, ok
+	}
+
+	symbol, ok = s.Outer.resolve(name, nested || s.owner == s)
+	if !ok || s.owner != s {
+		// Blocks share their function's frame, so nothing is captured
+		return symbol, ok
+	}
+
+	if symbol.Scope == GlobalScope || symbol.Scope == BuiltinScope {
+		return symbol, ok
+	}
+
+	return s.defineFree(symbol), true
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+	return symbol
+}
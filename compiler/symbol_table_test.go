@@ -0,0 +1,143 @@
+package compiler
+
+import "testing"
+
+func TestDefine(t *testing.T) {
+	expected := map[string]Symbol{
+		"a": {Name: "a", Scope: GlobalScope, Index: 0},
+		"b": {Name: "b", Scope: GlobalScope, Index: 1},
+		"c": {Name: "c", Scope: LocalScope, Index: 0},
+		"d": {Name: "d", Scope: LocalScope, Index: 1},
+	}
+
+	global := NewSymbolTable()
+	if a := global.Define("a"); a != expected["a"] {
+		t.Errorf("expected a=%+v, got=%+v", expected["a"], a)
+	}
+	if b := global.Define("b"); b != expected["b"] {
+		t.Errorf("expected b=%+v, got=%+v", expected["b"], b)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	if c := local.Define("c"); c != expected["c"] {
+		t.Errorf("expected c=%+v, got=%+v", expected["c"], c)
+	}
+	if d := local.Define("d"); d != expected["d"] {
+		t.Errorf("expected d=%+v, got=%+v", expected["d"], d)
+	}
+
+	// Redefining reuses the slot
+	if a := global.Define("a"); a != expected["a"] {
+		t.Errorf("expected redefined a=%+v, got=%+v", expected["a"], a)
+	}
+}
+
+func TestResolveNestedLocal(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+	global.DefineBuiltin(0, "len")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "len", Scope: BuiltinScope, Index: 0},
+		{Name: "c", Scope: FreeScope, Index: 0},
+		{Name: "e", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0].Name != "c" {
+		t.Errorf("wrong free symbols. got=%+v", secondLocal.FreeSymbols)
+	}
+
+	if _, ok := secondLocal.Resolve("z"); ok {
+		t.Errorf("name z resolved, but was never defined")
+	}
+}
+
+func TestBlockSymbolTable(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	block := NewBlockSymbolTable(global)
+	shadow := block.Define("a")
+	if shadow != (Symbol{Name: "a", Scope: GlobalScope, Index: 1}) {
+		t.Errorf("block definition should get a new global slot. got=%+v", shadow)
+	}
+
+	if a, _ := global.Resolve("a"); a.Index != 0 {
+		t.Errorf("block definition leaked into the outer table. got=%+v", a)
+	}
+
+	local := NewEnclosedSymbolTable(global)
+	local.Define("x")
+	inner := NewBlockSymbolTable(local)
+	y := inner.Define("y")
+	if y != (Symbol{Name: "y", Scope: LocalScope, Index: 1}) {
+		t.Errorf("block local should share the function's slots. got=%+v", y)
+	}
+
+	x, _ := inner.Resolve("x")
+	if x != (Symbol{Name: "x", Scope: LocalScope, Index: 0}) {
+		t.Errorf("function local seen from its block should stay local. got=%+v", x)
+	}
+
+	if local.NumDefinitions() != 2 {
+		t.Errorf("function should reserve slots for its blocks. got=%d", local.NumDefinitions())
+	}
+}
+
+func TestDefineAndResolveFunctionName(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineFunctionName("a")
+
+	expected := Symbol{Name: "a", Scope: FunctionScope, Index: 0}
+
+	result, ok := global.Resolve(expected.Name)
+	if !ok {
+		t.Fatalf("function name %s not resolvable", expected.Name)
+	}
+
+	if result != expected {
+		t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, result)
+	}
+}
+
+func TestResolveForwardLet(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+	local.Declare([]string{"odd"})
+	inner := NewEnclosedSymbolTable(local)
+
+	if _, ok := local.Resolve("odd"); ok {
+		t.Errorf("odd resolved in its own function before its let")
+	}
+
+	expected := Symbol{Name: "odd", Scope: FreeScope, Index: 0}
+	if result, ok := inner.Resolve("odd"); !ok || result != expected {
+		t.Errorf("expected odd to resolve to %+v in a nested function, got=%+v", expected, result)
+	}
+
+	expected = Symbol{Name: "odd", Scope: LocalScope, Index: 0}
+	if result := local.Define("odd"); result != expected {
+		t.Errorf("expected the let of odd to use the slot handed out early %+v, got=%+v", expected, result)
+	}
+	if local.NumDefinitions() != 1 {
+		t.Errorf("wrong number of definitions. want=1, got=%d", local.NumDefinitions())
+	}
+}
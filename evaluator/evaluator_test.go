@@ -1,9 +1,12 @@
 package evaluator
 
 import (
+	"galexw/monkey/ast"
 	"galexw/monkey/lexer"
 	"galexw/monkey/object"
 	"galexw/monkey/parser"
+	"galexw/monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -48,6 +51,12 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"1 + 1 >= 2 == true", true},
 	}
 
 	for _, tt := range tests {
@@ -96,6 +105,28 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"1 + 7 % 3 * 2", 3},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"(-2) ** 3", -8},
+		{"5 ** 0", 1},
+		{"6 & 3", 2},
+		{"6 | 3", 7},
+		{"6 ^ 3", 5},
+		{"~5", -6},
+		{"1 << 4", 16},
+		{"-16 >> 2", -4},
+		{"1 >> 70", 0},
+		{"1 | 2 ^ 3 & 4 << 1", 3},
+		{"-9223372036854775807 - 1", -9223372036854775807 - 1},
+		{"-1 << 63", -9223372036854775807 - 1},
+		{"0xFF + 0o17 + 0b1010", 280},
+		{"010 + 0755", 501},
+		{"1_000_000 / 1_000", 1000},
+		{"0xff & 0b1111_0000", 240},
 	}
 
 	for _, tt := range tests {
@@ -104,6 +135,99 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14", 3.14},
+		{"1e3", 1000},
+		{"2.5e-3", 0.0025},
+		{"-1.5", -1.5},
+		{"07.5", 7.5}, // decimal, unlike the octal 075
+		{"1.5 + 2.25", 3.75},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"10 / 4.0", 2.5},
+		{"10.0 / 4", 2.5},
+		{"3 * 1.5 - 1", 3.5},
+		{"7.5 % 2", 1.5},
+		{"2 ** 0.5 ** 2", 1.189207115002721},
+		{"4 ** 0.5", 2},
+		{"-(2.0 ** 2)", -4},
+		{"(1.8 * 100 + 32) * 1", 212},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestFloatComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1.5 < 2.5", true},
+		{"1.5 > 2.5", false},
+		{"2.5 <= 2.5", true},
+		{"2.5 >= 3", false},
+		{"1 == 1.0", true},
+		{"1.0 != 1", false},
+		{"0.1 + 0.2 == 0.3", false},
+		{"1 < 1.5", true},
+		{"2 > 1.5", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"4611686018427387904 * 2", "9223372036854775808"},
+		{"2 ** 100", "1267650600228229401496703205376"},
+		{"1 << 64", "18446744073709551616"},
+		{"-(-9223372036854775807 - 1)", "9223372036854775808"},
+		{"99999999999999999999", "99999999999999999999"},
+		{"-99999999999999999999", "-99999999999999999999"},
+		{"99999999999999999999 % 7", "1"},
+		{"2 ** 64 - 2 ** 64 + 1", "1"},
+		{"(2 ** 64) / (2 ** 62)", "4"},
+		{"~(2 ** 64)", "-18446744073709551617"},
+		{"2 ** 64 >> 60", "16"},
+		{"2 ** 64 == 18446744073709551616", "true"},
+		{"2 ** 64 > 2 ** 63", "true"},
+		{"2 ** 64 < 1", "false"},
+		{"2 ** 64 + 0.5", "1.8446744073709552e+19"},
+		{"int(1e19)", "10000000000000000000"},
+		{`int("123456789012345678901234567890")`, "123456789012345678901234567890"},
+		{"[1, 2][2 ** 64]", "null"},
+		{`{2 ** 64: "big"}[18446744073709551616]`, "big"},
+		{"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(25)", "15511210043330985984000000"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("%q wrong. want=%s, got=%s (%T)", tt.input, tt.expected, evaluated.Inspect(), evaluated)
+		}
+	}
+
+	// Results that fit go back to plain integers
+	if _, ok := testEval("2 ** 64 - 2 ** 64").(*object.Integer); !ok {
+		t.Errorf("small result of big integers isn't an *object.Integer")
+	}
+}
+
 func TestIfExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -116,6 +240,12 @@ func TestIfExpression(t *testing.T) {
 		{"if (1 > 2) { 10 }", nil}, // This is the expected behaviour
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (true) {}", nil},
+		{"if (false) { 10 } else {}", nil},
+		{"if (true) { let a = 1; }", nil},
+		{"fn() {}()", nil},
+		{"fn(x) { let y = x; }(1)", nil},
+		{"let f = fn() {}; let x = f(); x", nil},
 	}
 
 	for _, tt := range tests {
@@ -131,6 +261,46 @@ func TestIfExpression(t *testing.T) {
 	}
 }
 
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{} // int, bool, or nil for NULL
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"1 && 2", 2},
+		{"1 || 2", 1},
+		{"if (false) { 1 } || 3", 3},
+		{"if (false) { 1 } && 3", nil},
+		{"0 && 5", 5}, // 0 is truthy
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"false || false || 7", 7},
+		{"true && 1 + 1 == 2", true},
+		// The right side isn't evaluated when the left side decides
+		{"false && 1 / 0", false},
+		{"true || 1 / 0", true},
+		{"true || undefinedName", true},
+		{"let f = fn(x) { x > 0 || x / 0 }; f(1)", true},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestReturnStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -162,6 +332,30 @@ func TestErrorHandling(t *testing.T) {
 		expectedErrMsg string
 	}{
 		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"{aa: 1, bb: 2, cc: 3}", "identifier not found: aa"},
+		{`{"a": 1 / 0, "b": 2 + true}`, "division by zero: 1 / 0"},
+		{"1 / 0", "division by zero: 1 / 0"},
+		{"let f = fn(x) { 10 / x }; f(5) + f(0)", "division by zero: 10 / 0"},
+		{"5 % 0", "division by zero: 5 % 0"},
+		{"2 ** 10000000000", "integer too large: 2 ** 10000000000"},
+		{"(2 ** 64) ** 100000", "integer too large: 18446744073709551616 ** 100000"},
+		{"2 ** -1", "negative exponent: 2 ** -1"},
+		{"1 << 10000000000", "integer too large: 1 << 10000000000"},
+		{"1 << -1", "negative shift count: 1 << -1"},
+		{"1 >> -1", "negative shift count: 1 >> -1"},
+		{"2 ** 64 / 0", "division by zero: 18446744073709551616 / 0"},
+		{"~true", "unknown operator: ~BOOLEAN"},
+		{"true <= false", "unknown operator: BOOLEAN <= BOOLEAN"},
+		{"1.5 / 0", "division by zero: 1.5 / 0.0"},
+		{"1 % 0.0", "division by zero: 1.0 % 0.0"},
+		{"1.5 & 1", "unknown operator: FLOAT & INTEGER"},
+		{"~1.5", "unknown operator: ~FLOAT"},
+		{"1.5 + true", "type mismatch: FLOAT + BOOLEAN"},
+		{`"a" * 1.5`, "type mismatch: STRING * FLOAT"},
+		{"[1][0.0]", "index operator not supported: ARRAY[FLOAT]"},
+		{"let y = if (true) {}; y + 1", "type mismatch: NULL + INTEGER"},
+		{"{1.5: 1}", "unusable as hash key: FLOAT"},
+		{`"a" % "b"`, "unknown operator: STRING % STRING"},
 		{"5 + true; 5;", "type mismatch: INTEGER + BOOLEAN"},
 		{"-true", "unknown operator: -BOOLEAN"},
 		{"true + false;", "unknown operator: BOOLEAN + BOOLEAN"},
@@ -176,6 +370,21 @@ func TestErrorHandling(t *testing.T) {
 		}
 		`, "unknown operator: BOOLEAN + BOOLEAN"},
 		{"foobar", "identifier not found: foobar"},
+		{"let f = fn(x) { x }; f(1, 2);", "wrong number of arguments: want=1, got=2"},
+		{"let f = fn(x, y) { x + y }; f(1);", "wrong number of arguments: want=2, got=1"},
+		{"5(1);", "not a function: INTEGER"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`"Hello" + 1`, "type mismatch: STRING + INTEGER"},
+		{`1 + "Hello"`, "type mismatch: INTEGER + STRING"},
+		{`"a" == true`, "type mismatch: STRING == BOOLEAN"},
+		{`[1, 2]["a"]`, "index operator not supported: ARRAY[STRING]"},
+		{`5[0]`, "index operator not supported: INTEGER[INTEGER]"},
+		{`"abc"["a"]`, "index operator not supported: STRING[STRING]"},
+		{`[1, foobar]`, "identifier not found: foobar"},
+		{`{"name": "Monkey"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{`{[1]: 2}`, "unusable as hash key: ARRAY"},
+		{`{"a": foobar}`, "identifier not found: foobar"},
+		{"let f = fn(x) { x }; f(foobar);", "identifier not found: foobar"},
 	}
 
 	for _, tt := range tests {
@@ -194,6 +403,90 @@ func TestErrorHandling(t *testing.T) {
 	}
 }
 
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"5 + true;", 1, 3},
+		{"let a = 1;\nlet b = -true;", 2, 9},
+		{"let f = fn(x) {\n  x + foobar\n};\nf(1)", 2, 7},
+		{"len(1)", 1, 4},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Position.Line != tt.expectedLine || errObj.Position.Column != tt.expectedColumn {
+			t.Errorf("wrong error position for %q. expected=%d:%d, got=%s",
+				tt.input, tt.expectedLine, tt.expectedColumn, errObj.Position)
+		}
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{} // the result, or the error message
+	}{
+		{"let f = fn() { f() }; f()", "stack overflow"},
+		{"let f = fn(n) { 1 + f(n + 1) }; f(0)", "stack overflow"},
+		{"let even = fn(n) { odd(n + 1) }; let odd = fn(n) { even(n + 1) }; even(0)", "stack overflow"},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(1000)", 0},
+		{"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(10); f(10); f(1000)", 0},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("%s: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("%s: wrong error message. expected=%q, got=%q", tt.input, expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestPanicBecomesError(t *testing.T) {
+	// A prefix expression with no operand can't come out of the parser, so
+	// build it by hand to force a nil dereference inside the evaluator
+	node := &ast.ExpressionStatement{
+		Expression: &ast.PrefixExpression{
+			Token:    token.Token{Type: token.MINUS, Literal: "-", Position: token.Position{Line: 3, Column: 4}},
+			Operator: "-",
+		},
+	}
+
+	evaluated := Eval(node, object.NewEnvironment())
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if !strings.HasPrefix(errObj.Message, "internal error: ") {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	if errObj.Position.Line != 3 || errObj.Position.Column != 4 {
+		t.Errorf("wrong error position. got=%s", errObj.Position)
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -210,10 +503,490 @@ func TestLetStatements(t *testing.T) {
 	}
 }
 
+func TestFunctionObject(t *testing.T) {
+	input := "fn(x) { x + 2; };"
+
+	evaluated := testEval(input)
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(fn.Parameters) != 1 {
+		t.Fatalf("function has wrong parameters. Parameters=%+v", fn.Parameters)
+	}
+
+	if fn.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", fn.Parameters[0])
+	}
+
+	expectedBody := "(x + 2);"
+
+	if fn.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, fn.Body.String())
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let identity = fn(x) { return x; }; identity(5);", 5},
+		{"let double = fn(x) { x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let f = fn(x) { let y = x * 2; return y; 100 }; f(3) + 1;", 7},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+	let newAdder = fn(x) {
+		fn(y) { x + y };
+	};
+
+	let addTwo = newAdder(2);
+	addTwo(2);`
+
+	testIntegerObject(t, testEval(input), 4)
+}
+
+func TestRecursiveFunction(t *testing.T) {
+	input := `
+	let fib = fn(n) {
+		if (n < 2) { return n; }
+		fib(n - 1) + fib(n - 2)
+	};
+	fib(10);`
+
+	testIntegerObject(t, testEval(input), 55)
+}
+
+func TestHigherOrderFunctions(t *testing.T) {
+	input := `
+	let twice = fn(f, x) { f(f(x)) };
+	let compose = fn(f, g) { fn(x) { g(f(x)) } };
+	let inc = fn(x) { x + 1 };
+	let square = fn(x) { x * x };
+	compose(inc, square)(twice(inc, 1));`
+
+	testIntegerObject(t, testEval(input), 16)
+}
+
+func TestFunctionDoesNotLeakBindings(t *testing.T) {
+	input := `
+	let x = 1;
+	let f = fn(x) { let y = x; y };
+	f(10);
+	x;`
+
+	testIntegerObject(t, testEval(input), 1)
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a\tb\n"`, "a\tb\n"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"C:\\dir"`, `C:\dir`},
+		{`"caf\u{e9}"`, "café"},
+		{"`C:\\dir\n\\t`", "C:\\dir\n\\t"},
+		{"`a` + \"\\n\" + `b`", "a\nb"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if str.Value != tt.expected {
+			t.Errorf("%s: String has wrong value. want=%q, got=%q", tt.input, tt.expected, str.Value)
+		}
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `let greet = fn(name) { "Hello" + " " + name + "!" }; greet("World")`
+
+	evaluated := testEval(input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" != "a"`, false},
+		{`"ab" == "a" + "b"`, true},
+		{`let s = "x"; s == "x"`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][3]", nil},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][-4]", nil},
+		{"[][0]", nil},
+		{"[[1, 2], [3, 4]][1][0]", 3},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"abc"[0]`, "a"},
+		{`"abc"[-1]`, "c"},
+		{`"café"[3]`, "é"},
+		{`"😀 ok"[0]`, "😀"},
+		{`"😀 ok"[1]`, " "},
+		{`let s = "naïve"; s[len(s) - 3]`, "ï"},
+		{`"abc"[3]`, nil},
+		{`"abc"[-4]`, nil},
+		{`""[0]`, nil},
+		{`"abc"[18446744073709551616]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		expected, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+		str, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("%s: object is not String. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if str.Value != expected {
+			t.Errorf("%s: String has wrong value. want=%q, got=%q", tt.input, expected, str.Value)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := `let café = 3; let π = 4; let 名前 = café * π; 名前`
+	testIntegerObject(t, testEval(input), 12)
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`
+
+	evaluated := testEval(input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		TRUE.HashKey():                             5,
+		FALSE.HashKey():                            6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+
+	// Pairs print in the order they were written
+	if inspect := result.Inspect(); inspect != "{one: 1, two: 2, three: 3, 4: 4, true: 5, false: 6}" {
+		t.Errorf("Inspect wrong. got=%q", inspect)
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{1: 5}[true]`, nil},
+		{`{2 ** 64: 5}[2 ** 64]`, 5},
+		{`{2 ** 64: 5}[-1300789964862373523]`, nil},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len("café")`, 4},
+		{`len("\u{1F600}!")`, 2},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`len({"a": 1})`, 1},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments to `len`: got=2, want=1"},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` not supported, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "argument to `last` not supported, got INTEGER"},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int{1}},
+		{`push(1, 1)`, "argument to `push` not supported, got INTEGER"},
+		{`push([1])`, "wrong number of arguments to `push`: got=1, want=2"},
+		{`puts("hello", "world!")`, nil},
+		{`type(1)`, "INTEGER"},
+		{`type("a")`, "STRING"},
+		{`type([])`, "ARRAY"},
+		{`type(len)`, "BUILTIN"},
+		{`str(12)`, "12"},
+		{`str([1, 2])`, "[1, 2]"},
+		{`int("42")`, 42},
+		{`int(true)`, 1},
+		{`int(7)`, 7},
+		{`int("abc")`, "could not convert \"abc\" to integer in `int`"},
+		{`int([])`, "argument to `int` not supported, got ARRAY"},
+		{`int(3.99)`, 3},
+		{`int(-3.99)`, -3},
+		{`int(float("inf"))`, "could not convert +Inf to integer in `int`"},
+		{`float(2 ** 70)`, 1180591620717411303424.0},
+		{`type(2 ** 70)`, "INTEGER"},
+		{`int(float("nan"))`, "could not convert NaN to integer in `int`"},
+		{`float(3)`, 3.0},
+		{`float(2.5)`, 2.5},
+		{`float("1e-3")`, 0.001},
+		{`float("abc")`, "could not convert \"abc\" to float in `float`"},
+		{`float(true)`, "argument to `float` not supported, got BOOLEAN"},
+		{`type(1.5)`, "FLOAT"},
+		{`str(2.0)`, "2.0"},
+		{`str(0.1)`, "0.1"},
+		{`str(1e100)`, "1e+100"},
+		{`let len = fn(x) { 99 }; len("a")`, 99},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case float64:
+			testFloatObject(t, evaluated, expected)
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch obj := evaluated.(type) {
+			case *object.Error:
+				if obj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, obj.Message)
+				}
+			case *object.String:
+				if obj.Value != expected {
+					t.Errorf("wrong string. expected=%q, got=%q", expected, obj.Value)
+				}
+			default:
+				t.Errorf("object is not Error or String. got=%T (%+v)", evaluated, evaluated)
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		}
+	}
+}
+
+func TestMapAndReduce(t *testing.T) {
+	input := `
+	let map = fn(arr, f) {
+		let iter = fn(arr, accumulated) {
+			if (len(arr) == 0) {
+				accumulated
+			} else {
+				iter(rest(arr), push(accumulated, f(first(arr))));
+			}
+		};
+		iter(arr, []);
+	};
+
+	let reduce = fn(arr, initial, f) {
+		let iter = fn(arr, result) {
+			if (len(arr) == 0) {
+				result
+			} else {
+				iter(rest(arr), f(result, first(arr)));
+			}
+		};
+		iter(arr, initial);
+	};
+
+	let doubled = map([1, 2, 3, 4], fn(x) { x * 2 });
+	reduce(doubled, 0, fn(acc, x) { acc + x });`
+
+	testIntegerObject(t, testEval(input), 20)
+}
+
+func TestBlockScopes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; if (true) { let x = 2; x }", 2},
+		{"let x = 1; if (true) { let x = 2; }; x", 1},
+		{"let x = 1; if (true) { x + 1 }", 2},
+		{"let x = 1; let f = fn() { let x = 5; if (true) { let x = 10; } x }; f() + x", 6},
+		{"let x = 1; let f = fn() { x }; let x = 2; f()", 2},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestBlockBindingsDoNotLeak(t *testing.T) {
+	evaluated := testEval("if (true) { let y = 2; }; y")
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Message != "identifier not found: y" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
-	program := p.ParseProgram()
+	program, _ := p.ParseProgram()
 	env := object.NewEnvironment()
 
 	return Eval(program, env)
@@ -235,6 +1008,22 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	return true
 }
 
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	result, ok := obj.(*object.Boolean)
 
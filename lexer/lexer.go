@@ -1,31 +1,77 @@
 package lexer
 
 import (
+	"fmt"
 	"galexw/monkey/token"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Lexer struct {
 	input        string
+	filename     string
 	position     int  // current position in input (points to current char)
 	nextPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	ch           rune // current char under examination
+	line         int  // line of the current char, starting at 1
+	column       int  // column of the current char in runes, starting at 1
+	keepComments bool // return comments as COMMENT tokens instead of skipping them
 }
 
 func New(input string) *Lexer { // Input here is actually the source code in Monkey
-	l := &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile is like New, but records filename in the position of every token
+func NewFile(filename, input string) *Lexer {
+	l := &Lexer{input: input, filename: filename, line: 1}
 	l.readChar()
+	l.skipShebang()
 	return l
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token { // ch is the character that is being read
+// Input returns the source the lexer was created with
+func (l *Lexer) Input() string {
+	return l.input
+}
+
+// skipShebang skips a "#!" line at the very start of the input, so scripts
+// can be made executable. The line still counts for positions
+func (l *Lexer) skipShebang() {
+	if l.ch != '#' || l.peekChar() != '!' {
+		return
+	}
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+func newToken(tokenType token.TokenType, ch rune) token.Token { // ch is the character that is being read
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+// KeepComments makes NextToken return comments as COMMENT tokens, for tools
+// that need to put them back into the source, instead of skipping them
+func (l *Lexer) KeepComments() {
+	l.keepComments = true
+}
+
 func (l *Lexer) NextToken() token.Token {
+	tok := l.scanToken()
+	for tok.Type == token.COMMENT && !l.keepComments {
+		tok = l.scanToken()
+	}
+	return tok
+}
+
+func (l *Lexer) scanToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
 
+	pos := l.currentPosition()
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -50,13 +96,74 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '*' {
+			l.readChar()
+			tok = token.Token{Type: token.POWER, Literal: "**"}
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		switch l.peekChar() {
+		case '/':
+			tok.Type = token.COMMENT
+			tok.Literal = l.readLineComment()
+			tok.Position = pos
+			return tok
+		case '*':
+			literal, terminated := l.readBlockComment()
+			tok.Type = token.COMMENT
+			if !terminated {
+				tok.Type = token.ILLEGAL
+			}
+			tok.Literal = literal
+			tok.Position = pos
+			return tok
+		default:
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '<':
-		tok = newToken(token.LESSTHAN, l.ch)
+		// Look at the next character too, to tell <, <= and << apart
+		switch l.peekChar() {
+		case '=':
+			l.readChar()
+			tok = token.Token{Type: token.LESSEQUAL, Literal: "<="}
+		case '<':
+			l.readChar()
+			tok = token.Token{Type: token.SHIFTLEFT, Literal: "<<"}
+		default:
+			tok = newToken(token.LESSTHAN, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GREATERTHAN, l.ch)
+		switch l.peekChar() {
+		case '=':
+			l.readChar()
+			tok = token.Token{Type: token.GREATEREQUAL, Literal: ">="}
+		case '>':
+			l.readChar()
+			tok = token.Token{Type: token.SHIFTRIGHT, Literal: ">>"}
+		default:
+			tok = newToken(token.GREATERTHAN, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			l.readChar()
+			tok = token.Token{Type: token.AND, Literal: "&&"}
+		} else {
+			tok = newToken(token.AMPERSAND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			l.readChar()
+			tok = token.Token{Type: token.OR, Literal: "||"}
+		} else {
+			tok = newToken(token.PIPE, l.ch)
+		}
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '~':
+		tok = newToken(token.TILDE, l.ch)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ':':
@@ -75,9 +182,13 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LEFTBRACKET, l.ch)
 	case ']':
 		tok = newToken(token.RIGHTBRACKET, l.ch)
-	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+	case '"', '`':
+		raw := l.readString(l.ch)
+		if value, reason := unquote(raw); reason == "" {
+			tok = token.Token{Type: token.STRING, Literal: value}
+		} else {
+			tok = token.Token{Type: token.ILLEGAL, Literal: raw}
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -85,20 +196,33 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Position = pos
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Position = pos
 			return tok
 		} else {
-			tok = newToken(token.ILLEGAL, l.ch)
+			// Slice the input rather than using l.ch, which is
+			// utf8.RuneError for every byte that isn't valid UTF-8
+			tok = token.Token{Type: token.ILLEGAL, Literal: l.input[l.position:l.nextPosition]}
 		}
 	}
 
 	l.readChar()
+	tok.Position = pos
 	return tok
 }
 
+func (l *Lexer) currentPosition() token.Position {
+	return token.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' { // While the character is a whitespace
 		l.readChar()
@@ -106,9 +230,12 @@ func (l *Lexer) skipWhitespace() {
 }
 
 // Helper functions
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' ||
-		ch == '_' // Allow underscores in identifiers
+func isLetter(ch rune) bool {
+	if ch < utf8.RuneSelf {
+		return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' ||
+			ch == '_' // Allow underscores in identifiers
+	}
+	return unicode.IsLetter(ch) // like é or λ, so identifiers can be in any language
 }
 
 func (l *Lexer) readIdentifier() string {
@@ -121,41 +248,85 @@ func (l *Lexer) readIdentifier() string {
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
-	position := l.position
-
-	for isDigit(l.ch) { // While the character is a digit
-		l.readChar()
-	}
-
-	return l.input[position:l.position]
-}
-
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9' // If the character is a digit
 }
 
+// readChar moves to the next rune of the input. Invalid UTF-8 is read one
+// byte at a time, as utf8.RuneError
 func (l *Lexer) readChar() {
-	l.ch = l.peekChar()
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	l.position = l.nextPosition
-	l.nextPosition += 1
+	if l.position >= len(l.input) {
+		l.ch = 0
+		return
+	}
+	ch, width := utf8.DecodeRuneInString(l.input[l.position:])
+	l.ch = ch
+	l.nextPosition += width
+}
+
+// readLineComment reads a // comment up to, but not including, the end of
+// the line
+func (l *Lexer) readLineComment() string {
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+	return l.input[position:l.position]
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1 // +1 to skip the opening double quote
-	for {
+// readBlockComment reads a /* */ comment, which may contain other block
+// comments. If the input ends first, everything up to the end is returned
+// and terminated is false
+func (l *Lexer) readBlockComment() (literal string, terminated bool) {
+	position := l.position
+	depth := 0
+	for l.ch != 0 {
+		if l.ch == '/' && l.peekChar() == '*' {
+			depth++
+			l.readChar()
+		} else if l.ch == '*' && l.peekChar() == '/' {
+			depth--
+			l.readChar()
+		}
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 { // If the character is a double quote or EOF
-			break
+
+		if depth == 0 {
+			return l.input[position:l.position], true
 		}
 	}
-	return l.input[position:l.position]
+	return l.input[position:l.position], false
+}
+
+// IllegalReason explains why tok, an ILLEGAL token, couldn't be lexed
+func IllegalReason(tok token.Token) string {
+	if strings.HasPrefix(tok.Literal, "/*") {
+		return "Unterminated block comment"
+	}
+	if !utf8.ValidString(tok.Literal) {
+		return fmt.Sprintf("Invalid UTF-8 byte %q", tok.Literal)
+	}
+	if tok.Literal != "" && isDigit(rune(tok.Literal[0])) {
+		_, reason := checkNumber(tok.Literal)
+		return reason
+	}
+	if tok.Literal != "" && (tok.Literal[0] == '"' || tok.Literal[0] == '`') {
+		_, reason := unquote(tok.Literal)
+		return reason
+	}
+	return fmt.Sprintf("Illegal character %q", tok.Literal)
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.nextPosition >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.nextPosition]
 	}
+	ch, _ := utf8.DecodeRuneInString(l.input[l.nextPosition:])
+	return ch
 }
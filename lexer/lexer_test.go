@@ -15,7 +15,7 @@ func TestNextToken(t *testing.T) {
 		};
 
 		let result = add(five, ten);
-		!-/*5;
+		!-/ *5;
 		5 < 10 > 5;
 
 		if (5 < 10) {
@@ -29,6 +29,8 @@ func TestNextToken(t *testing.T) {
 		"foo bar"
 		[1, 2];
 		{"foo": "bar"}
+		a && b || c & d |
+		a <= b >= c % d ** e ^ ~f << g >> h *
 	`
 
 	tests := []struct {
@@ -121,6 +123,31 @@ func TestNextToken(t *testing.T) {
 		{token.COLON, ":"},
 		{token.STRING, "bar"},
 		{token.RIGHTBRACE, "}"},
+		{token.IDENTIFIER, "a"},
+		{token.AND, "&&"},
+		{token.IDENTIFIER, "b"},
+		{token.OR, "||"},
+		{token.IDENTIFIER, "c"},
+		{token.AMPERSAND, "&"},
+		{token.IDENTIFIER, "d"},
+		{token.PIPE, "|"},
+		{token.IDENTIFIER, "a"},
+		{token.LESSEQUAL, "<="},
+		{token.IDENTIFIER, "b"},
+		{token.GREATEREQUAL, ">="},
+		{token.IDENTIFIER, "c"},
+		{token.PERCENT, "%"},
+		{token.IDENTIFIER, "d"},
+		{token.POWER, "**"},
+		{token.IDENTIFIER, "e"},
+		{token.CARET, "^"},
+		{token.TILDE, "~"},
+		{token.IDENTIFIER, "f"},
+		{token.SHIFTLEFT, "<<"},
+		{token.IDENTIFIER, "g"},
+		{token.SHIFTRIGHT, ">>"},
+		{token.IDENTIFIER, "h"},
+		{token.ASTERISK, "*"},
 		{token.EOF, ""},
 	}
 
@@ -137,3 +164,281 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n\tx + \"a\nb\";\nfoo"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+		expectedOffset  int
+	}{
+		{"let", 1, 1, 0},
+		{"x", 1, 5, 4},
+		{"=", 1, 7, 6},
+		{"5", 1, 9, 8},
+		{";", 1, 10, 9},
+		{"x", 2, 2, 12},
+		{"+", 2, 4, 14},
+		{"a\nb", 2, 6, 16},
+		{";", 3, 3, 21},
+		{"foo", 4, 1, 23},
+		{"", 4, 4, 26},
+	}
+
+	l := NewFile("test.mk", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		pos := tok.Position
+		if pos.Line != tt.expectedLine || pos.Column != tt.expectedColumn || pos.Offset != tt.expectedOffset {
+			t.Errorf("tests[%d] - position wrong for %q. expected=%d:%d@%d, got=%d:%d@%d", i, tt.expectedLiteral,
+				tt.expectedLine, tt.expectedColumn, tt.expectedOffset, pos.Line, pos.Column, pos.Offset)
+		}
+
+		if pos.Filename != "test.mk" {
+			t.Errorf("tests[%d] - filename wrong. got=%q", i, pos.Filename)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "let café = \"☕\";\nλ € \xff _ok"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+		expectedOffset  int
+	}{
+		{token.LET, "let", 1, 1, 0},
+		{token.IDENTIFIER, "café", 1, 5, 4},
+		{token.ASSIGN, "=", 1, 10, 10},
+		{token.STRING, "☕", 1, 12, 12},
+		{token.SEMICOLON, ";", 1, 15, 17},
+		{token.IDENTIFIER, "λ", 2, 1, 19},
+		{token.ILLEGAL, "€", 2, 3, 22},
+		{token.ILLEGAL, "\xff", 2, 5, 26},
+		{token.IDENTIFIER, "_ok", 2, 7, 28},
+		{token.EOF, "", 2, 10, 31},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		pos := tok.Position
+		if pos.Line != tt.expectedLine || pos.Column != tt.expectedColumn || pos.Offset != tt.expectedOffset {
+			t.Errorf("tests[%d] - position wrong for %q. expected=%d:%d@%d, got=%d:%d@%d", i, tt.expectedLiteral,
+				tt.expectedLine, tt.expectedColumn, tt.expectedOffset, pos.Line, pos.Column, pos.Offset)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{"42", []token.Token{{Type: token.INT, Literal: "42"}}},
+		{"3.14", []token.Token{{Type: token.FLOAT, Literal: "3.14"}}},
+		{"1e-9", []token.Token{{Type: token.FLOAT, Literal: "1e-9"}}},
+		{"1E+10", []token.Token{{Type: token.FLOAT, Literal: "1E+10"}}},
+		{"6.02e23", []token.Token{{Type: token.FLOAT, Literal: "6.02e23"}}},
+		{"1.", []token.Token{{Type: token.INT, Literal: "1"}, {Type: token.ILLEGAL, Literal: "."}}},
+		{"1.x", []token.Token{{Type: token.INT, Literal: "1"}, {Type: token.ILLEGAL, Literal: "."}, {Type: token.IDENTIFIER, Literal: "x"}}},
+		{"1e", []token.Token{{Type: token.ILLEGAL, Literal: "1e"}}},
+		{"2e-x", []token.Token{{Type: token.ILLEGAL, Literal: "2e-x"}}},
+		{"0xFF", []token.Token{{Type: token.INT, Literal: "0xFF"}}},
+		{"0o17", []token.Token{{Type: token.INT, Literal: "0o17"}}},
+		{"0b1010", []token.Token{{Type: token.INT, Literal: "0b1010"}}},
+		{"0B1_0", []token.Token{{Type: token.INT, Literal: "0B1_0"}}},
+		{"0x_FF", []token.Token{{Type: token.INT, Literal: "0x_FF"}}},
+		{"1_000_000", []token.Token{{Type: token.INT, Literal: "1_000_000"}}},
+		{"1_000.000_1e1_0", []token.Token{{Type: token.FLOAT, Literal: "1_000.000_1e1_0"}}},
+		{"0x1e+5", []token.Token{{Type: token.INT, Literal: "0x1e"}, {Type: token.PLUS, Literal: "+"}, {Type: token.INT, Literal: "5"}}},
+		{"0 0.5 07.5", []token.Token{{Type: token.INT, Literal: "0"}, {Type: token.FLOAT, Literal: "0.5"}, {Type: token.FLOAT, Literal: "07.5"}}},
+		{"0x", []token.Token{{Type: token.ILLEGAL, Literal: "0x"}}},
+		{"1__0", []token.Token{{Type: token.ILLEGAL, Literal: "1__0"}}},
+		{"1_ + 2", []token.Token{{Type: token.ILLEGAL, Literal: "1_"}, {Type: token.PLUS, Literal: "+"}, {Type: token.INT, Literal: "2"}}},
+		{"0b102", []token.Token{{Type: token.ILLEGAL, Literal: "0b102"}}},
+		{"0o8", []token.Token{{Type: token.ILLEGAL, Literal: "0o8"}}},
+		{"123abc", []token.Token{{Type: token.ILLEGAL, Literal: "123abc"}}},
+		{"017 0_17 00", []token.Token{{Type: token.INT, Literal: "017"}, {Type: token.INT, Literal: "0_17"}, {Type: token.INT, Literal: "00"}}},
+		{"019", []token.Token{{Type: token.ILLEGAL, Literal: "019"}}},
+		{"1e5e5", []token.Token{{Type: token.ILLEGAL, Literal: "1e5e5"}}},
+		{"12é", []token.Token{{Type: token.ILLEGAL, Literal: "12é"}}},
+		{"1.5.5", []token.Token{{Type: token.FLOAT, Literal: "1.5"}, {Type: token.ILLEGAL, Literal: "."}, {Type: token.INT, Literal: "5"}}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Errorf("%q - tokens[%d] wrong. expected=%s %q, got=%s %q",
+					tt.input, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("%q - expected EOF, got %s %q", tt.input, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.Token
+	}{
+		{`"abc"`, []token.Token{{Type: token.STRING, Literal: "abc"}}},
+		{`""`, []token.Token{{Type: token.STRING, Literal: ""}}},
+		{`"a\nb\tc\rd"`, []token.Token{{Type: token.STRING, Literal: "a\nb\tc\rd"}}},
+		{`"say \"hi\" \\o/"`, []token.Token{{Type: token.STRING, Literal: `say "hi" \o/`}}},
+		{`"\u{48}\u{e9}\u{1F600}"`, []token.Token{{Type: token.STRING, Literal: "Hé😀"}}},
+		{`"\\" + "x"`, []token.Token{{Type: token.STRING, Literal: `\`}, {Type: token.PLUS, Literal: "+"}, {Type: token.STRING, Literal: "x"}}},
+		{"\"a\nb\"", []token.Token{{Type: token.STRING, Literal: "a\nb"}}},
+		{"`raw \\n \"`", []token.Token{{Type: token.STRING, Literal: `raw \n "`}}},
+		{"`one\ntwo`", []token.Token{{Type: token.STRING, Literal: "one\ntwo"}}},
+		{"\"abc", []token.Token{{Type: token.ILLEGAL, Literal: "\"abc"}}},
+		{`"abc\"`, []token.Token{{Type: token.ILLEGAL, Literal: `"abc\"`}}},
+		{`"abc\`, []token.Token{{Type: token.ILLEGAL, Literal: `"abc\`}}},
+		{"`abc", []token.Token{{Type: token.ILLEGAL, Literal: "`abc"}}},
+		{`"a\qb" 1`, []token.Token{{Type: token.ILLEGAL, Literal: `"a\qb"`}, {Type: token.INT, Literal: "1"}}},
+		{`"\u{D800}"`, []token.Token{{Type: token.ILLEGAL, Literal: `"\u{D800}"`}}},
+		{`"\u{110000}"`, []token.Token{{Type: token.ILLEGAL, Literal: `"\u{110000}"`}}},
+		{`"\u{}"`, []token.Token{{Type: token.ILLEGAL, Literal: `"\u{}"`}}},
+		{`"\u0041"`, []token.Token{{Type: token.ILLEGAL, Literal: `"\u0041"`}}},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for i, expected := range tt.expected {
+			tok := l.NextToken()
+			if tok.Type != expected.Type || tok.Literal != expected.Literal {
+				t.Errorf("%q - tokens[%d] wrong. expected=%s %q, got=%s %q",
+					tt.input, i, expected.Type, expected.Literal, tok.Type, tok.Literal)
+			}
+		}
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("%q - expected EOF, got %s %q", tt.input, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedLine    int
+	}{
+		{"#!/usr/bin/env monkey\nlet", "let", 2},
+		{"#!/usr/bin/env monkey", "", 1},
+		{"#!/usr/bin/env monkey\n\n  5", "5", 3},
+	}
+
+	for _, tt := range tests {
+		tok := New(tt.input).NextToken()
+		if tok.Literal != tt.expectedLiteral || tok.Position.Line != tt.expectedLine {
+			t.Errorf("first token of %q wrong. expected=%q on line %d, got=%q on line %d",
+				tt.input, tt.expectedLiteral, tt.expectedLine, tok.Literal, tok.Position.Line)
+		}
+	}
+
+	// Only the first line may be a shebang
+	l := New("5\n#!")
+	l.NextToken()
+	if tok := l.NextToken(); tok.Type != token.ILLEGAL {
+		t.Errorf("expected ILLEGAL for a later #!, got %q", tok.Type)
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `let a = 1; // the first
+/* a block
+   comment */ a / 2
+/* outer /* inner */ still outer */ a`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{token.LET, "let", 1, 1},
+		{token.IDENTIFIER, "a", 1, 5},
+		{token.ASSIGN, "=", 1, 7},
+		{token.INT, "1", 1, 9},
+		{token.SEMICOLON, ";", 1, 10},
+		{token.COMMENT, "// the first", 1, 12},
+		{token.COMMENT, "/* a block\n   comment */", 2, 1},
+		{token.IDENTIFIER, "a", 3, 15},
+		{token.SLASH, "/", 3, 17},
+		{token.INT, "2", 3, 19},
+		{token.COMMENT, "/* outer /* inner */ still outer */", 4, 1},
+		{token.IDENTIFIER, "a", 4, 37},
+		{token.EOF, "", 4, 38},
+	}
+
+	kept := New(input)
+	kept.KeepComments()
+	skipped := New(input)
+
+	for i, tt := range tests {
+		tok := kept.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Position.Line != tt.expectedLine || tok.Position.Column != tt.expectedColumn {
+			t.Errorf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d",
+				i, tt.expectedLine, tt.expectedColumn, tok.Position.Line, tok.Position.Column)
+		}
+
+		if tt.expectedType == token.COMMENT {
+			continue
+		}
+		if tok := skipped.NextToken(); tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong when skipping comments. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	tests := []string{
+		"1 /* never closed",
+		"1 /* outer /* inner */ but not outer",
+		"1 /*/",
+	}
+
+	for _, input := range tests {
+		l := New(input)
+		l.NextToken()
+
+		tok := l.NextToken()
+		if tok.Type != token.ILLEGAL {
+			t.Fatalf("%q - expected ILLEGAL, got %s %q", input, tok.Type, tok.Literal)
+		}
+		if tok.Literal != input[2:] || tok.Position.Column != 3 {
+			t.Errorf("%q - wrong token. got %q at column %d", input, tok.Literal, tok.Position.Column)
+		}
+		if reason := IllegalReason(tok); reason != "Unterminated block comment" {
+			t.Errorf("%q - wrong reason %q", input, reason)
+		}
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("%q - expected EOF after the comment, got %s", input, tok.Type)
+		}
+	}
+}
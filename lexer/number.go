@@ -0,0 +1,141 @@
+package lexer
+
+import (
+	"fmt"
+	"galexw/monkey/token"
+	"strings"
+)
+
+// Prefixes of the integer literals that aren't decimal
+var bases = map[rune]struct {
+	base int
+	name string
+}{
+	'x': {16, "Hexadecimal"}, 'X': {16, "Hexadecimal"},
+	'o': {8, "Octal"}, 'O': {8, "Octal"},
+	'b': {2, "Binary"}, 'B': {2, "Binary"},
+}
+
+// readNumber reads a number literal: a decimal, hexadecimal, octal (with a
+// 0o prefix or just a leading zero) or binary integer, or a decimal float with a fraction or an exponent. Any
+// letters, digits and underscores stuck to it are read too, so something
+// like 0b102 or 1__0 becomes one ILLEGAL token instead of a number followed
+// by something odd. A dot only belongs to the number when a digit follows it
+func (l *Lexer) readNumber() (token.TokenType, string) {
+	position := l.position
+
+	_, hasBase := bases[l.peekChar()]
+	prefixed := l.ch == '0' && hasBase
+	if prefixed {
+		l.readChar()
+		l.readChar()
+	}
+
+	seenDot := false
+	for {
+		switch {
+		case isDigit(l.ch) || isLetter(l.ch):
+			if !prefixed && (l.ch == 'e' || l.ch == 'E') && (l.peekChar() == '+' || l.peekChar() == '-') {
+				l.readChar() // the exponent's sign
+			}
+			l.readChar()
+		case l.ch == '.' && !prefixed && !seenDot && isDigit(l.peekChar()):
+			seenDot = true
+			l.readChar()
+		default:
+			literal := l.input[position:l.position]
+			tokenType, _ := checkNumber(literal)
+			return tokenType, literal
+		}
+	}
+}
+
+// checkNumber works out whether literal is an INT or a FLOAT. If it is
+// malformed the type is ILLEGAL and reason says what is wrong with it
+func checkNumber(literal string) (tokenType token.TokenType, reason string) {
+	if len(literal) > 1 && literal[0] == '0' {
+		if prefix, ok := bases[rune(literal[1])]; ok {
+			return checkPrefixedInteger(literal, prefix.base, prefix.name)
+		}
+	}
+
+	for _, ch := range literal {
+		if !isDigit(ch) && !strings.ContainsRune("_.eE+-", ch) {
+			return token.ILLEGAL, fmt.Sprintf("Invalid character %q in number %s", ch, literal)
+		}
+	}
+
+	mantissa, exponent, hasExponent := strings.Cut(strings.ToLower(literal), "e")
+	integer, fraction, hasFraction := strings.Cut(mantissa, ".")
+	if hasExponent {
+		exponent = strings.TrimLeft(exponent, "+-")
+		if exponent == "" {
+			return token.ILLEGAL, fmt.Sprintf("Exponent has no digits in %s", literal)
+		}
+	}
+
+	for _, part := range []string{integer, fraction, exponent} {
+		if strings.Trim(part, "0123456789_") != "" {
+			return token.ILLEGAL, fmt.Sprintf("Malformed number %s", literal) // like a second exponent
+		}
+		if !separatesDigits(part) {
+			return token.ILLEGAL, fmt.Sprintf("Underscores must be between digits in %s", literal)
+		}
+	}
+
+	if !hasFraction && !hasExponent {
+		// A leading zero still makes an octal literal, as it always has,
+		// so 0755 is 493. Floats like 07.5 stay decimal
+		if digits := strings.ReplaceAll(integer, "_", ""); len(digits) > 1 && digits[0] == '0' {
+			for _, ch := range digits {
+				if digitValue(ch) >= 8 {
+					return token.ILLEGAL, fmt.Sprintf("Invalid digit %q in octal literal %s", ch, literal)
+				}
+			}
+		}
+		return token.INT, ""
+	}
+	return token.FLOAT, ""
+}
+
+func checkPrefixedInteger(literal string, base int, name string) (token.TokenType, string) {
+	// An underscore may follow the prefix, like in 0x_FF
+	digits := strings.TrimPrefix(literal[2:], "_")
+	if digits == "" {
+		return token.ILLEGAL, fmt.Sprintf("%s literal %s has no digits", name, literal)
+	}
+
+	for _, ch := range digits {
+		if ch != '_' && digitValue(ch) >= base {
+			return token.ILLEGAL, fmt.Sprintf("Invalid digit %q in %s literal %s",
+				ch, strings.ToLower(name), literal)
+		}
+	}
+	if !separatesDigits(digits) {
+		return token.ILLEGAL, fmt.Sprintf("Underscores must be between digits in %s", literal)
+	}
+
+	return token.INT, ""
+}
+
+// separatesDigits reports whether every underscore in digits is between two
+// digits
+func separatesDigits(digits string) bool {
+	return !strings.HasPrefix(digits, "_") && !strings.HasSuffix(digits, "_") &&
+		!strings.Contains(digits, "__")
+}
+
+// digitValue is the value of a digit in bases up to 16. Anything else is
+// worth 16, which is too much for every base
+func digitValue(ch rune) int {
+	switch {
+	case isDigit(ch):
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'F':
+		return int(ch-'A') + 10
+	default:
+		return 16
+	}
+}
@@ -0,0 +1,103 @@
+package lexer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// readString reads a string literal starting at the opening quote, which
+// is " for strings with escape sequences and ` for raw strings. It returns
+// the source of the literal, quotes included, and stops at the end of the
+// input when the closing quote is missing
+func (l *Lexer) readString(quote rune) string {
+	position := l.position
+	for {
+		l.readChar()
+		if l.ch == 0 {
+			return l.input[position:l.position]
+		}
+		if quote == '"' && l.ch == '\\' {
+			l.readChar() // the escaped character, which can be a quote
+			if l.ch == 0 {
+				return l.input[position:l.position]
+			}
+			continue
+		}
+		if l.ch == quote {
+			return l.input[position : l.position+1]
+		}
+	}
+}
+
+// unquote returns the value of a string literal read by readString. Raw
+// strings are taken as they are, other strings have their escape sequences
+// replaced. If the literal is malformed, reason says what is wrong with it
+func unquote(raw string) (value string, reason string) {
+	quote := raw[0]
+	if len(raw) < 2 || raw[len(raw)-1] != quote {
+		if quote == '`' {
+			return "", "Unterminated raw string"
+		}
+		return "", "Unterminated string"
+	}
+	if quote == '`' {
+		return raw[1 : len(raw)-1], ""
+	}
+
+	var out strings.Builder
+	for i := 1; i < len(raw)-1; i++ {
+		if raw[i] != '\\' {
+			out.WriteByte(raw[i])
+			continue
+		}
+
+		// A \ right before the last quote escapes it, so the string ran
+		// into the end of the input without being closed
+		i++
+		if i == len(raw)-1 {
+			return "", "Unterminated string"
+		}
+		switch raw[i] {
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case 'r':
+			out.WriteByte('\r')
+		case '"':
+			out.WriteByte('"')
+		case '\\':
+			out.WriteByte('\\')
+		case 'u':
+			r, length := unicodeEscape(raw[i+1:])
+			if length == 0 {
+				return "", "Invalid unicode escape in string, expected \\u{...} with 1 to 6 hex digits of a code point"
+			}
+			out.WriteRune(r)
+			i += length
+		default:
+			escape, _ := utf8.DecodeRuneInString(raw[i:])
+			return "", fmt.Sprintf("Unknown escape sequence \\%c in string", escape)
+		}
+	}
+
+	return out.String(), ""
+}
+
+// unicodeEscape reads the {...} part of a \u{...} escape at the start of s.
+// It returns the code point and how many bytes the braces took, or 0 if they
+// aren't a valid code point
+func unicodeEscape(s string) (rune, int) {
+	end := strings.IndexByte(s, '}')
+	if !strings.HasPrefix(s, "{") || end < 2 || end > 7 {
+		return 0, 0
+	}
+
+	code, err := strconv.ParseUint(s[1:end], 16, 32)
+	if err != nil || !utf8.ValidRune(rune(code)) {
+		return 0, 0
+	}
+	return rune(code), end + 1
+}
@@ -0,0 +1,61 @@
+package lineedit
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// History is the list of lines entered so far, oldest first. It keeps at
+// most max lines, dropping the oldest
+type History struct {
+	entries []string
+	max     int
+}
+
+func NewHistory(max int) *History {
+	return &History{max: max}
+}
+
+// Add appends line, unless it's blank or repeats the previous line
+func (h *History) Add(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(h.entries); n > 0 && h.entries[n-1] == line {
+		return
+	}
+
+	h.entries = append(h.entries, line)
+	if len(h.entries) > h.max {
+		h.entries = h.entries[len(h.entries)-h.max:]
+	}
+}
+
+func (h *History) Len() int {
+	return len(h.entries)
+}
+
+// At returns the i-th line, 0 being the oldest
+func (h *History) At(i int) string {
+	return h.entries[i]
+}
+
+// Load adds every line read from r
+func (h *History) Load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		h.Add(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Save writes the lines to w, one per line, so Load can read them back
+func (h *History) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, line := range h.entries {
+		bw.WriteString(line)
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,417 @@
+// Package lineedit reads lines from a terminal with cursor movement, history
+// and tab completion, using the usual emacs style keys:
+//
+//	Left, Right, Ctrl-B, Ctrl-F   move the cursor
+//	Home, End, Ctrl-A, Ctrl-E     move to the start or end of the line
+//	Up, Down, Ctrl-P, Ctrl-N      step through the history
+//	Ctrl-R                        search the history, Ctrl-R again for older matches
+//	Backspace, Delete, Ctrl-D     delete a character, Ctrl-D on an empty line is EOF
+//	Ctrl-W, Ctrl-U, Ctrl-K        delete the word before the cursor, or up to the start or end
+//	Ctrl-L                        clear the screen
+//	Ctrl-C                        abandon the line
+//	Tab                           complete the word before the cursor
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C
+var ErrInterrupted = errors.New("interrupted")
+
+// Editor reads lines from in, drawing them on out
+type Editor struct {
+	in  *bufio.Reader
+	out io.Writer
+	fd  int // the terminal put in raw mode while reading, or -1
+
+	History *History
+
+	// Complete returns the completions of word, the text before the cursor
+	// made of letters, digits, '_' and ':'. Every completion must start with
+	// word. It may be nil
+	Complete func(word string) []string
+}
+
+// New creates an Editor. When in is a terminal it is switched to raw mode
+// for the duration of each ReadLine; any other reader is read as it is,
+// which is mostly useful for tests
+func New(in io.Reader, out io.Writer) *Editor {
+	fd := -1
+	if f, ok := in.(*os.File); ok && IsTerminal(int(f.Fd())) {
+		fd = int(f.Fd())
+	}
+	return &Editor{in: bufio.NewReader(in), out: out, fd: fd, History: NewHistory(1000)}
+}
+
+// ReadLine shows prompt and returns the line the user entered, without the
+// line ending, adding it to the history. It returns io.EOF for Ctrl-D on an
+// empty line or at the end of the input, and ErrInterrupted for Ctrl-C
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.fd >= 0 {
+		restore, err := makeRaw(e.fd)
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	s := &state{e: e, prompt: prompt, historyIndex: e.History.Len()}
+	s.refresh()
+
+	line, err := s.edit()
+	if err == nil {
+		e.History.Add(line)
+	}
+	return line, err
+}
+
+// Special keys, decoded from escape sequences
+const (
+	keyUp rune = -(iota + 1)
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+	keyUnknown
+)
+
+const (
+	ctrlA     = 1
+	ctrlB     = 2
+	ctrlC     = 3
+	ctrlD     = 4
+	ctrlE     = 5
+	ctrlF     = 6
+	ctrlG     = 7
+	ctrlH     = 8
+	tab       = 9
+	newline   = 10
+	ctrlK     = 11
+	ctrlL     = 12
+	enter     = 13
+	ctrlN     = 14
+	ctrlP     = 16
+	ctrlR     = 18
+	ctrlU     = 21
+	ctrlW     = 23
+	esc       = 27
+	backspace = 127
+)
+
+// state is the line being edited by one ReadLine call
+type state struct {
+	e      *Editor
+	prompt string
+	buf    []rune
+	pos    int // cursor position in buf
+
+	historyIndex int    // the history line shown, History.Len() for the new line
+	saved        []rune // the new line, while browsing the history
+}
+
+func (s *state) edit() (string, error) {
+	for {
+		key, err := s.readKey()
+		if err != nil {
+			if err == io.EOF && len(s.buf) > 0 {
+				return string(s.buf), nil
+			}
+			return "", err
+		}
+
+		if key == ctrlR {
+			if key, err = s.search(); err != nil {
+				return "", err
+			}
+		}
+
+		switch key {
+		case enter, newline:
+			s.write("\r\n")
+			return string(s.buf), nil
+		case ctrlC:
+			s.write("^C\r\n")
+			return "", ErrInterrupted
+		case ctrlD:
+			if len(s.buf) == 0 {
+				s.write("\r\n")
+				return "", io.EOF
+			}
+			s.deleteForward()
+		case ctrlA, keyHome:
+			s.pos = 0
+		case ctrlE, keyEnd:
+			s.pos = len(s.buf)
+		case ctrlB, keyLeft:
+			if s.pos > 0 {
+				s.pos--
+			}
+		case ctrlF, keyRight:
+			if s.pos < len(s.buf) {
+				s.pos++
+			}
+		case ctrlP, keyUp:
+			s.showHistory(s.historyIndex - 1)
+		case ctrlN, keyDown:
+			s.showHistory(s.historyIndex + 1)
+		case backspace, ctrlH:
+			if s.pos > 0 {
+				s.buf = append(s.buf[:s.pos-1], s.buf[s.pos:]...)
+				s.pos--
+			}
+		case keyDelete:
+			s.deleteForward()
+		case ctrlK:
+			s.buf = s.buf[:s.pos]
+		case ctrlU:
+			s.buf = append([]rune{}, s.buf[s.pos:]...)
+			s.pos = 0
+		case ctrlW:
+			start := s.pos
+			for start > 0 && unicode.IsSpace(s.buf[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(s.buf[start-1]) {
+				start--
+			}
+			s.buf = append(s.buf[:start], s.buf[s.pos:]...)
+			s.pos = start
+		case ctrlL:
+			s.write("\x1b[H\x1b[2J")
+		case tab:
+			s.complete()
+		case 0:
+			// A search that was cancelled
+		default:
+			if key > 0 && unicode.IsPrint(key) {
+				s.insert([]rune{key})
+			}
+		}
+
+		s.refresh()
+	}
+}
+
+// readKey reads one key press, decoding the escape sequences sent for the
+// arrow and editing keys
+func (s *state) readKey() (rune, error) {
+	r, _, err := s.e.in.ReadRune()
+	if err != nil || r != esc {
+		return r, err
+	}
+
+	// ESC [ or ESC O, then optional digits and a final character
+	intro, _, err := s.e.in.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if intro != '[' && intro != 'O' {
+		return keyUnknown, nil
+	}
+
+	var params strings.Builder
+	for {
+		r, _, err = s.e.in.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if (r < '0' || r > '9') && r != ';' {
+			break
+		}
+		params.WriteRune(r)
+	}
+
+	switch r {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	case '~':
+		switch params.String() {
+		case "1", "7":
+			return keyHome, nil
+		case "4", "8":
+			return keyEnd, nil
+		case "3":
+			return keyDelete, nil
+		}
+	}
+	return keyUnknown, nil
+}
+
+func (s *state) write(text string) {
+	io.WriteString(s.e.out, text)
+}
+
+// refresh redraws the line and puts the cursor back in place
+func (s *state) refresh() {
+	s.draw(s.prompt, s.buf, s.pos)
+}
+
+func (s *state) draw(prompt string, buf []rune, pos int) {
+	var out strings.Builder
+	out.WriteString("\r")
+	out.WriteString(prompt)
+	out.WriteString(string(buf))
+	out.WriteString("\x1b[K") // clear whatever was drawn after it before
+	if back := len(buf) - pos; back > 0 {
+		fmt.Fprintf(&out, "\x1b[%dD", back)
+	}
+	s.write(out.String())
+}
+
+func (s *state) insert(runes []rune) {
+	buf := make([]rune, 0, len(s.buf)+len(runes))
+	buf = append(buf, s.buf[:s.pos]...)
+	buf = append(buf, runes...)
+	s.buf = append(buf, s.buf[s.pos:]...)
+	s.pos += len(runes)
+}
+
+func (s *state) deleteForward() {
+	if s.pos < len(s.buf) {
+		s.buf = append(s.buf[:s.pos], s.buf[s.pos+1:]...)
+	}
+}
+
+// showHistory replaces the line with history line i, where History.Len()
+// is the line that was being typed before browsing
+func (s *state) showHistory(i int) {
+	history := s.e.History
+	if i < 0 || i > history.Len() {
+		return
+	}
+
+	if s.historyIndex == history.Len() {
+		s.saved = s.buf
+	}
+	s.historyIndex = i
+
+	if i == history.Len() {
+		s.buf = s.saved
+	} else {
+		s.buf = []rune(history.At(i))
+	}
+	s.pos = len(s.buf)
+}
+
+// search runs an incremental search backwards through the history. Typing
+// narrows the search and Ctrl-R finds the next older match. Ctrl-G or
+// Ctrl-C cancel it and leave the line as it was; any other key takes the
+// match as the line and is then handled as usual, so Enter runs it
+func (s *state) search() (rune, error) {
+	history := s.e.History
+	var query []rune
+	match := history.Len()
+
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if strings.Contains(history.At(i), string(query)) {
+				match = i
+				return
+			}
+		}
+	}
+
+	for {
+		found := ""
+		if match < history.Len() {
+			found = history.At(match)
+		}
+		s.draw(fmt.Sprintf("(reverse-i-search)`%s': ", string(query)), []rune(found), 0)
+
+		key, err := s.readKey()
+		if err != nil {
+			return 0, err
+		}
+
+		switch {
+		case key == ctrlR:
+			find(match - 1)
+		case key == backspace || key == ctrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(history.Len() - 1)
+			}
+		case key == ctrlG || key == ctrlC:
+			return 0, nil
+		case key > 0 && unicode.IsPrint(key):
+			query = append(query, key)
+			if match == history.Len() {
+				find(match - 1)
+			} else {
+				find(match)
+			}
+		default:
+			if match < history.Len() {
+				s.buf = []rune(found)
+				s.pos = len(s.buf)
+				s.historyIndex = history.Len()
+			}
+			return key, nil
+		}
+	}
+}
+
+// complete extends the word before the cursor as far as all completions
+// agree, and lists them if that doesn't get any further
+func (s *state) complete() {
+	if s.e.Complete == nil {
+		return
+	}
+
+	start := s.pos
+	for start > 0 && isWordRune(s.buf[start-1]) {
+		start--
+	}
+	word := string(s.buf[start:s.pos])
+
+	completions := s.e.Complete(word)
+	if len(completions) == 0 {
+		s.write("\a")
+		return
+	}
+
+	prefix := commonPrefix(completions)
+	if len(prefix) > len(word) {
+		s.insert([]rune(prefix[len(word):]))
+		return
+	}
+
+	if len(completions) > 1 {
+		s.write("\r\n" + strings.Join(completions, "  ") + "\r\n")
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == ':'
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,189 @@
+package lineedit
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+const (
+	up    = "\x1b[A"
+	down  = "\x1b[B"
+	right = "\x1b[C"
+	left  = "\x1b[D"
+	home  = "\x1b[H"
+	end   = "\x1b[F"
+	del   = "\x1b[3~"
+)
+
+func TestReadLineEditing(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{"let x = 5\r", "let x = 5"},
+		{"let x = 5\n", "let x = 5"},
+		{"let  = 5" + left + left + left + left + "x\r", "let x = 5"},
+		{"et x" + home + "l" + end + " = 1\r", "let x = 1"},
+		{"\x01l\x05 = 2\r", "l = 2"},
+		{"abcd\x7f\x7f\r", "ab"},
+		{"abcd" + left + left + del + "\r", "abd"},
+		{"abcd" + left + left + "\x04\r", "abd"},
+		{"abc" + left + "\x0b\r", "ab"},
+		{"abc def" + left + left + left + "\x15\r", "def"},
+		{"let add = fn\x17\r", "let add = "},
+		{"ab" + right + right + left + "X\r", "aXb"},
+		{"héllo" + left + left + left + "\x7f\r", "hllo"},
+		{"abc", "abc"}, // EOF ends the line
+	}
+
+	for _, tt := range tests {
+		e := New(strings.NewReader(tt.keys), io.Discard)
+
+		line, err := e.ReadLine(">>> ")
+		if err != nil {
+			t.Fatalf("ReadLine(%q) error: %s", tt.keys, err)
+		}
+		if line != tt.expected {
+			t.Errorf("ReadLine(%q) wrong. want=%q, got=%q", tt.keys, tt.expected, line)
+		}
+	}
+}
+
+func TestReadLineEndings(t *testing.T) {
+	e := New(strings.NewReader("ab\x03\x04"), io.Discard)
+
+	if _, err := e.ReadLine(">>> "); !errors.Is(err, ErrInterrupted) {
+		t.Errorf("expected ErrInterrupted for Ctrl-C, got %v", err)
+	}
+	if _, err := e.ReadLine(">>> "); err != io.EOF {
+		t.Errorf("expected io.EOF for Ctrl-D, got %v", err)
+	}
+	if _, err := e.ReadLine(">>> "); err != io.EOF {
+		t.Errorf("expected io.EOF at the end of the input, got %v", err)
+	}
+}
+
+func TestReadLineHistory(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected string
+	}{
+		{up + "\r", "third"},
+		{up + up + "\r", "second"},
+		{up + up + up + up + up + "\r", "first"},
+		{up + up + down + "\r", "third"},
+		{"new" + up + down + "\r", "new"},
+		{up + "!\r", "third!"},
+		{"\x10\x10\x0e\r", "third"},
+		{"\x12sec\r", "second"},
+		{"\x12d\x12\r", "second"},
+		{"\x12ir\x12\r", "first"},
+		{"\x12xyz\r", ""},
+		{"\x12thi\x7f\x7f\x7f\x7fsec\r", "second"},
+		{"mine\x12fir\x07\r", "mine"},
+		{"\x12fir" + end + "!\r", "first!"},
+	}
+
+	for _, tt := range tests {
+		e := New(strings.NewReader(tt.keys), io.Discard)
+		e.History.Add("first")
+		e.History.Add("second")
+		e.History.Add("third")
+
+		line, err := e.ReadLine(">>> ")
+		if err != nil {
+			t.Fatalf("ReadLine(%q) error: %s", tt.keys, err)
+		}
+		if line != tt.expected {
+			t.Errorf("ReadLine(%q) wrong. want=%q, got=%q", tt.keys, tt.expected, line)
+		}
+	}
+}
+
+func TestReadLineCompletion(t *testing.T) {
+	words := []string{"let", "len", "last", "lengthy", ":load"}
+	complete := func(word string) []string {
+		var found []string
+		for _, w := range words {
+			if strings.HasPrefix(w, word) {
+				found = append(found, w)
+			}
+		}
+		return found
+	}
+
+	tests := []struct {
+		keys     string
+		expected string
+		listed   string
+	}{
+		{"la\t\r", "last", ""},
+		{"le\t\r", "le", "let  len  lengthy"},
+		{"leng\t\r", "lengthy", ""},
+		{"len\t\r", "len", "len  lengthy"},
+		{"x\t\r", "x", ""},
+		{"puts(la\t)\r", "puts(last)", ""},
+		{":l\t f\r", ":load f", ""},
+		{"la" + home + "\t\r", "la", ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := New(strings.NewReader(tt.keys), &out)
+		e.Complete = complete
+
+		line, err := e.ReadLine(">>> ")
+		if err != nil {
+			t.Fatalf("ReadLine(%q) error: %s", tt.keys, err)
+		}
+		if line != tt.expected {
+			t.Errorf("ReadLine(%q) wrong. want=%q, got=%q", tt.keys, tt.expected, line)
+		}
+		if tt.listed != "" && !strings.Contains(out.String(), "\r\n"+tt.listed+"\r\n") {
+			t.Errorf("ReadLine(%q) didn't list %q. output=%q", tt.keys, tt.listed, out.String())
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	h := NewHistory(3)
+	for _, line := range []string{"a", "", "b", "b", "  ", "c", "d"} {
+		h.Add(line)
+	}
+
+	var saved bytes.Buffer
+	if err := h.Save(&saved); err != nil {
+		t.Fatalf("Save error: %s", err)
+	}
+	if saved.String() != "b\nc\nd\n" {
+		t.Errorf("saved history wrong. got=%q", saved.String())
+	}
+
+	loaded := NewHistory(2)
+	if err := loaded.Load(&saved); err != nil {
+		t.Fatalf("Load error: %s", err)
+	}
+	if loaded.Len() != 2 || loaded.At(0) != "c" || loaded.At(1) != "d" {
+		t.Errorf("loaded history wrong. got=%v", loaded.entries)
+	}
+}
+
+func TestReadLineAddsToHistory(t *testing.T) {
+	e := New(strings.NewReader("one\rtwo\r\x03"+up+up+"\r"), io.Discard)
+
+	e.ReadLine(">>> ")
+	e.ReadLine(">>> ")
+	e.ReadLine(">>> ")
+
+	line, _ := e.ReadLine(">>> ")
+	if line != "one" {
+		t.Errorf("expected the earlier lines in the history, got %q", line)
+	}
+	// The interrupted line isn't kept, the recalled one is added again
+	if e.History.Len() != 3 || e.History.At(2) != "one" {
+		t.Errorf("history wrong. got=%v", e.History.entries)
+	}
+}
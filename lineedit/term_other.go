@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package lineedit
+
+import "errors"
+
+// IsTerminal always reports false here, so callers fall back to reading
+// plain lines
+func IsTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("line editing is not supported on this platform")
+}
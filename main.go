@@ -1,13 +1,71 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"galexw/monkey/ast"
+	"galexw/monkey/bytecode"
+	"galexw/monkey/compiler"
+	"galexw/monkey/evaluator"
+	"galexw/monkey/lexer"
+	"galexw/monkey/object"
+	"galexw/monkey/parser"
 	"galexw/monkey/repl"
+	"galexw/monkey/token"
+	"galexw/monkey/vm"
+	"io"
 	"os"
 	"os/user"
+	"strings"
+)
+
+const usage = `usage:
+	monkey                          start the REPL, or run the program piped to stdin
+	monkey run file.mk              run a source or compiled bytecode file
+	monkey file.mk                  same as run, for #! scripts
+	monkey -e 'expr'                run expr and print its value
+	monkey build file.mk [-o out]   compile file.mk to bytecode (default out: file.mkc)
+	monkey dump --tokens|--ast|--bytecode file.mk
+	                                print the tokens, syntax tree or bytecode of file.mk
+`
+
+// Exit codes
+const (
+	exitOK           = 0
+	exitRuntimeError = 1 // also used when a file can't be read or written
+	exitParseError   = 2 // also used for bad command line usage
 )
 
 func main() {
+	args := os.Args[1:]
+
+	switch {
+	case len(args) == 0 && stdinIsTerminal():
+		startRepl()
+	case len(args) == 0:
+		os.Exit(runStdin())
+	case args[0] == "run" && len(args) == 2:
+		os.Exit(runFile(args[1]))
+	case args[0] == "-e" && len(args) == 2:
+		os.Exit(runSource("", args[1], true))
+	case args[0] == "build":
+		os.Exit(build(args[1:]))
+	case args[0] == "dump":
+		os.Exit(dump(args[1:]))
+	case len(args) == 1 && !strings.HasPrefix(args[0], "-"):
+		os.Exit(runFile(args[0]))
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(exitParseError)
+	}
+}
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func startRepl() {
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -16,3 +74,249 @@ func main() {
 	fmt.Printf("Feel free to type in commands\n")
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+func runStdin() int {
+	source, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntimeError
+	}
+	return runSource("<stdin>", string(source), false)
+}
+
+// runFile runs a compiled .mkc file in the VM, or evaluates anything else as
+// source
+func runFile(path string) int {
+	if strings.HasSuffix(path, ".mkc") {
+		return runBytecode(path)
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntimeError
+	}
+	return runSource(path, string(source), false)
+}
+
+// runSource parses and evaluates a whole program. Errors go to stderr with
+// the offending source line, and the value of the program is printed only
+// when printResult is set, as scripts print with puts
+func runSource(filename, source string, printResult bool) int {
+	p := parser.New(lexer.NewFile(filename, source))
+	program, err := p.ParseProgram()
+	if err != nil {
+		printParserErrors(source, err)
+		return exitParseError
+	}
+
+	evaluated := evaluator.Eval(program, object.NewEnvironment())
+
+	if err, ok := evaluated.(*object.Error); ok {
+		fmt.Fprintln(os.Stderr, err.Inspect())
+		if snippet := token.Highlight(source, err.Position); snippet != "" {
+			fmt.Fprintln(os.Stderr, snippet)
+		}
+		return exitRuntimeError
+	}
+
+	if printResult && evaluated != nil && evaluated != evaluator.NULL {
+		fmt.Println(evaluated.Inspect())
+	}
+	return exitOK
+}
+
+// build compiles a source file and writes the encoded bytecode next to it,
+// or to the file given with -o
+func build(args []string) int {
+	var input, output string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-o" && i+1 < len(args):
+			output = args[i+1]
+			i++
+		case input == "" && !strings.HasPrefix(args[i], "-"):
+			input = args[i]
+		default:
+			fmt.Fprint(os.Stderr, usage)
+			return exitParseError
+		}
+	}
+	if input == "" {
+		fmt.Fprint(os.Stderr, usage)
+		return exitParseError
+	}
+	if output == "" {
+		output = strings.TrimSuffix(input, ".mk") + ".mkc"
+	}
+
+	source, err := os.ReadFile(input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntimeError
+	}
+
+	p := parser.New(lexer.NewFile(input, string(source)))
+	program, err := p.ParseProgram()
+	if err != nil {
+		printParserErrors(string(source), err)
+		return exitParseError
+	}
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		fmt.Fprintf(os.Stderr, "compile error: %s\n", err)
+		return exitRuntimeError
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntimeError
+	}
+	if err := bytecode.Encode(f, comp.Bytecode()); err != nil {
+		f.Close()
+		fmt.Fprintf(os.Stderr, "%s: %s\n", output, err)
+		return exitRuntimeError
+	}
+	if err := f.Close(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntimeError
+	}
+	return exitOK
+}
+
+// dump prints what the front end makes of a source file, one section per
+// requested flag, in the order they were given
+func dump(args []string) int {
+	var modes []string
+	var input string
+	for _, arg := range args {
+		switch {
+		case arg == "--tokens" || arg == "--ast" || arg == "--bytecode":
+			modes = append(modes, arg)
+		case input == "" && !strings.HasPrefix(arg, "-"):
+			input = arg
+		default:
+			fmt.Fprint(os.Stderr, usage)
+			return exitParseError
+		}
+	}
+	if input == "" || len(modes) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return exitParseError
+	}
+
+	source, err := os.ReadFile(input)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntimeError
+	}
+
+	for _, mode := range modes {
+		if len(modes) > 1 {
+			fmt.Printf("== %s ==\n", strings.TrimPrefix(mode, "--"))
+		}
+		if mode == "--tokens" {
+			dumpTokens(input, string(source))
+			continue
+		}
+
+		l := lexer.NewFile(input, string(source))
+		if mode == "--ast" {
+			l.KeepComments()
+		}
+
+		p := parser.New(l)
+		program, err := p.ParseProgram()
+		if err != nil {
+			printParserErrors(string(source), err)
+			return exitParseError
+		}
+
+		if mode == "--ast" {
+			ast.Dump(os.Stdout, program)
+			continue
+		}
+
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			fmt.Fprintf(os.Stderr, "compile error: %s\n", err)
+			return exitRuntimeError
+		}
+		compiler.Disassemble(os.Stdout, comp.Bytecode())
+	}
+	return exitOK
+}
+
+func dumpTokens(filename, source string) {
+	l := lexer.NewFile(filename, source)
+	l.KeepComments()
+	for {
+		tok := l.NextToken()
+		fmt.Printf("%-12s %-12s %q\n", tok.Position, tok.Type, tok.Literal)
+		if tok.Type == token.EOF {
+			return
+		}
+	}
+}
+
+// runBytecode runs a compiled file. Decode rejects files whose instructions
+// point outside of the program, but anything it misses is reported as an
+// internal error rather than crashing
+func runBytecode(path string) (code int) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: internal error: %v\n", r)
+			code = exitRuntimeError
+		}
+	}()
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitRuntimeError
+	}
+	defer f.Close()
+
+	bc, err := bytecode.Decode(f)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", path, err)
+		return exitRuntimeError
+	}
+
+	machine := vm.New(bc)
+	if err := machine.Run(); err != nil {
+		printRuntimeError(err)
+		return exitRuntimeError
+	}
+	return exitOK
+}
+
+// printRuntimeError prints a VM error like the evaluator's, with the source
+// line when the file it was compiled from can still be read
+func printRuntimeError(err error) {
+	var rerr *vm.RuntimeError
+	if !errors.As(err, &rerr) || !rerr.Position.IsValid() {
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", err)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "ERROR: %s: %s\n", rerr.Position, rerr.Message)
+	if source, err := os.ReadFile(rerr.Position.Filename); err == nil {
+		if snippet := token.Highlight(string(source), rerr.Position); snippet != "" {
+			fmt.Fprintln(os.Stderr, snippet)
+		}
+	}
+}
+
+func printParserErrors(source string, err error) {
+	var errs parser.ErrorList
+	if !errors.As(err, &errs) {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	for _, e := range errs {
+		fmt.Fprintln(os.Stderr, e.Format(source))
+	}
+}
@@ -0,0 +1,224 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// Builtins is shared by the evaluator and the compiler. The compiler refers
+// to a builtin by its index here, so new builtins must only be appended.
+// A builtin returns nil where Monkey expects null
+var Builtins = []struct {
+	Name    string
+	Builtin *Builtin
+}{
+	{
+		"len",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return wrongNumberOfArguments("len", len(args), 1)
+			}
+
+			switch arg := args[0].(type) {
+			case *String:
+				return &Integer{Value: int64(arg.Length())}
+			case *Array:
+				return &Integer{Value: int64(len(arg.Elements))}
+			case *Hash:
+				return &Integer{Value: int64(len(arg.Pairs))}
+			default:
+				return unsupportedArgument("len", args[0])
+			}
+		}},
+	},
+	{
+		"first",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return wrongNumberOfArguments("first", len(args), 1)
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return unsupportedArgument("first", args[0])
+			}
+
+			arr := args[0].(*Array)
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
+
+			return nil
+		}},
+	},
+	{
+		"last",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return wrongNumberOfArguments("last", len(args), 1)
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return unsupportedArgument("last", args[0])
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				return arr.Elements[length-1]
+			}
+
+			return nil
+		}},
+	},
+	{
+		"rest",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return wrongNumberOfArguments("rest", len(args), 1)
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return unsupportedArgument("rest", args[0])
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+			if length > 0 {
+				// Arrays are immutable, so rest hands back a fresh copy
+				newElements := make([]Object, length-1)
+				copy(newElements, arr.Elements[1:length])
+				return &Array{Elements: newElements}
+			}
+
+			return nil
+		}},
+	},
+	{
+		"push",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return wrongNumberOfArguments("push", len(args), 2)
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return unsupportedArgument("push", args[0])
+			}
+
+			arr := args[0].(*Array)
+			length := len(arr.Elements)
+
+			newElements := make([]Object, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
+
+			return &Array{Elements: newElements}
+		}},
+	},
+	{
+		"puts",
+		&Builtin{Fn: func(args ...Object) Object {
+			for _, arg := range args {
+				fmt.Println(arg.Inspect())
+			}
+
+			return nil
+		}},
+	},
+	{
+		"type",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return wrongNumberOfArguments("type", len(args), 1)
+			}
+
+			return &String{Value: string(args[0].Type())}
+		}},
+	},
+	{
+		"str",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return wrongNumberOfArguments("str", len(args), 1)
+			}
+
+			return &String{Value: args[0].Inspect()}
+		}},
+	},
+	{
+		"int",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return wrongNumberOfArguments("int", len(args), 1)
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer, *BigInteger:
+				return arg
+			case *Boolean:
+				if arg.Value {
+					return &Integer{Value: 1}
+				}
+				return &Integer{Value: 0}
+			case *Float:
+				if math.IsNaN(arg.Value) || math.IsInf(arg.Value, 0) {
+					return newError("could not convert %s to integer in `int`", arg.Inspect())
+				}
+				// Truncates towards zero
+				value, _ := big.NewFloat(arg.Value).Int(nil)
+				return IntegerFromBig(value)
+			case *String:
+				value, ok := new(big.Int).SetString(arg.Value, 10)
+				if !ok {
+					return newError("could not convert %q to integer in `int`", arg.Value)
+				}
+				return IntegerFromBig(value)
+			default:
+				return unsupportedArgument("int", args[0])
+			}
+		}},
+	},
+	{
+		"float",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return wrongNumberOfArguments("float", len(args), 1)
+			}
+
+			switch arg := args[0].(type) {
+			case *Integer, *BigInteger:
+				value, _ := ToFloat(arg)
+				return &Float{Value: value}
+			case *Float:
+				return arg
+			case *String:
+				value, err := strconv.ParseFloat(arg.Value, 64)
+				if err != nil {
+					return newError("could not convert %q to float in `float`", arg.Value)
+				}
+				return &Float{Value: value}
+			default:
+				return unsupportedArgument("float", args[0])
+			}
+		}},
+	},
+}
+
+// GetBuiltinByName returns nil if there is no builtin called name
+func GetBuiltinByName(name string) *Builtin {
+	for _, def := range Builtins {
+		if def.Name == name {
+			return def.Builtin
+		}
+	}
+	return nil
+}
+
+func newError(format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func wrongNumberOfArguments(name string, got, want int) *Error {
+	return newError("wrong number of arguments to `%s`: got=%d, want=%d", name, got, want)
+}
+
+func unsupportedArgument(name string, arg Object) *Error {
+	return newError("argument to `%s` not supported, got %s", name, arg.Type())
+}
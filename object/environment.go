@@ -1,16 +1,47 @@
 package object
 
+import "sort"
+
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s}
+	return &Environment{store: s, outer: nil}
+}
+
+// NewEnclosedEnvironment creates a scope nested inside outer. Lookups that
+// miss locally fall through to outer, but bindings always land locally
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	env.calls = outer.calls
+	return env
+}
+
+// NewCallEnvironment creates the scope of a call to a function defined in
+// outer. caller is the scope the call is made from, the new scope is one
+// call deeper than it
+func NewCallEnvironment(outer, caller *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.calls = caller.calls + 1
+	return env
 }
 
 type Environment struct {
 	store map[string]Object
+	outer *Environment
+	calls int // function calls that are active in this scope
+}
+
+// CallDepth is the number of function calls that led to this scope, 0 at
+// the top level of a program
+func (e *Environment) CallDepth() int {
+	return e.calls
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
 	obj, ok := e.store[name]
+	if !ok && e.outer != nil {
+		obj, ok = e.outer.Get(name)
+	}
 	return obj, ok
 }
 
@@ -18,3 +49,14 @@ func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// Names returns the names bound directly in this environment, not in the
+// ones enclosing it, in sorted order
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
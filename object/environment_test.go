@@ -0,0 +1,84 @@
+package object
+
+import "testing"
+
+func TestCallDepth(t *testing.T) {
+	global := NewEnvironment()
+	definition := NewEnclosedEnvironment(global)
+	caller := NewCallEnvironment(global, global)
+	call := NewCallEnvironment(definition, caller)
+	block := NewEnclosedEnvironment(call)
+
+	tests := []struct {
+		env      *Environment
+		expected int
+	}{
+		{global, 0},
+		{definition, 0},
+		{caller, 1},
+		{call, 2},
+		{block, 2},
+	}
+
+	for i, tt := range tests {
+		if got := tt.env.CallDepth(); got != tt.expected {
+			t.Errorf("tests[%d] - CallDepth() wrong. want=%d, got=%d", i, tt.expected, got)
+		}
+	}
+}
+
+func TestEnclosedEnvironment(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("a", &Integer{Value: 1})
+	outer.Set("b", &Integer{Value: 2})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("b", &Integer{Value: 20})
+	inner.Set("c", &Integer{Value: 30})
+
+	tests := []struct {
+		env      *Environment
+		name     string
+		expected int64
+		found    bool
+	}{
+		{inner, "a", 1, true},
+		{inner, "b", 20, true},
+		{inner, "c", 30, true},
+		{outer, "b", 2, true},
+		{outer, "c", 0, false},
+	}
+
+	for _, tt := range tests {
+		obj, ok := tt.env.Get(tt.name)
+		if ok != tt.found {
+			t.Errorf("Get(%q) found=%t, want=%t", tt.name, ok, tt.found)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if obj.(*Integer).Value != tt.expected {
+			t.Errorf("Get(%q) = %d, want=%d", tt.name, obj.(*Integer).Value, tt.expected)
+		}
+	}
+}
+
+func TestEnvironmentNames(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("z", &Integer{Value: 1})
+
+	inner := NewEnclosedEnvironment(outer)
+	inner.Set("b", &Integer{Value: 2})
+	inner.Set("a", &Integer{Value: 3})
+	inner.Set("b", &Integer{Value: 4})
+
+	names := inner.Names()
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("Names() wrong. want=[a b], got=%v", names)
+	}
+
+	if names := NewEnvironment().Names(); len(names) != 0 {
+		t.Errorf("Names() of an empty environment wrong. got=%v", names)
+	}
+}
@@ -0,0 +1,62 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// FloatInfix applies an arithmetic operator to two floats. Like
+// IntegerInfix it is shared by the evaluator and the VM. Division by zero is
+// an error rather than an infinity, the same as for integers
+func FloatInfix(operator string, left, right float64) (float64, error) {
+	switch operator {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/", "%":
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero: %s %s %s", formatFloat(left), operator, formatFloat(right))
+		}
+		if operator == "%" {
+			return math.Mod(left, right), nil
+		}
+		return left / right, nil
+	case "**":
+		return math.Pow(left, right), nil
+	default:
+		return 0, ErrUnknownOperator
+	}
+}
+
+// ToFloat converts integers and floats to a float64, for arithmetic that
+// mixes the two. ok is false for any other object
+func ToFloat(obj Object) (value float64, ok bool) {
+	switch obj := obj.(type) {
+	case *Integer:
+		return float64(obj.Value), true
+	case *BigInteger:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return value, true
+	case *Float:
+		return obj.Value, true
+	default:
+		return 0, false
+	}
+}
+
+// formatFloat prints the shortest representation that reads back as the
+// same float, keeping a ".0" on whole numbers so they don't look like
+// integers
+func formatFloat(value float64) string {
+	s := strconv.FormatFloat(value, 'g', -1, 64)
+	if strings.ContainsAny(s, ".eIN") {
+		return s
+	}
+	return s + ".0"
+}
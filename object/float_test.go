@@ -0,0 +1,70 @@
+package object
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestFloatInfix(t *testing.T) {
+	tests := []struct {
+		operator    string
+		left, right float64
+		expected    float64
+		err         string
+	}{
+		{"+", 1.5, 2.25, 3.75, ""},
+		{"-", 1, 2.5, -1.5, ""},
+		{"*", 1.5, 4, 6, ""},
+		{"/", 1, 8, 0.125, ""},
+		{"/", 1, 0, 0, "division by zero: 1.0 / 0.0"},
+		{"%", 7.5, 2, 1.5, ""},
+		{"%", -7.5, 2, -1.5, ""},
+		{"%", 7.5, 0, 0, "division by zero: 7.5 % 0.0"},
+		{"**", 2, -1, 0.5, ""},
+		{"**", 9, 0.5, 3, ""},
+	}
+
+	for _, tt := range tests {
+		result, err := FloatInfix(tt.operator, tt.left, tt.right)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%g %s %g: expected error %q, got %v", tt.left, tt.operator, tt.right, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%g %s %g: unexpected error %s", tt.left, tt.operator, tt.right, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("%g %s %g: wrong result. want=%g, got=%g", tt.left, tt.operator, tt.right, tt.expected, result)
+		}
+	}
+
+	if _, err := FloatInfix("&", 1, 2); !errors.Is(err, ErrUnknownOperator) {
+		t.Errorf("expected ErrUnknownOperator for &, got %v", err)
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{1, "1.0"},
+		{-2, "-2.0"},
+		{0.1, "0.1"},
+		{3.14, "3.14"},
+		{1e21, "1e+21"},
+		{1e-9, "1e-09"},
+		{math.Inf(1), "+Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("Inspect() of %g wrong. want=%q, got=%q", tt.value, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package object
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// ErrUnknownOperator is returned by IntegerInfix and FloatInfix for
+// operators they don't apply, so callers can report them their own way
+var ErrUnknownOperator = errors.New("unknown operator")
+
+// errOverflow is returned by int64Infix when the result doesn't fit an
+// int64, so IntegerInfix redoes the operation with big integers
+var errOverflow = errors.New("integer overflow")
+
+// maxIntegerBits bounds the integers that ** and << build, so something
+// like 2 ** 10000000000 fails straight away instead of eating all the memory
+const maxIntegerBits = 1 << 20
+
+// IntegerInfix applies an arithmetic or bitwise operator to two integers,
+// each an *Integer or a *BigInteger. Results that overflow an int64 become a
+// *BigInteger and results that fit one become an *Integer again, so Monkey
+// code only ever sees a single INTEGER type. The evaluator and the VM both
+// use it, so they agree on the results and on the error messages
+func IntegerInfix(operator string, left, right Object) (Object, error) {
+	if l, ok := left.(*Integer); ok {
+		if r, ok := right.(*Integer); ok {
+			result, err := int64Infix(operator, l.Value, r.Value)
+			if err != errOverflow {
+				if err != nil {
+					return nil, err
+				}
+				return &Integer{Value: result}, nil
+			}
+		}
+	}
+
+	return bigInfix(operator, toBigInt(left), toBigInt(right))
+}
+
+// int64Infix is the fast path of IntegerInfix, used while both operands
+// are small
+func int64Infix(operator string, left, right int64) (int64, error) {
+	switch operator {
+	case "+":
+		result := left + right
+		if (left > 0 && right > 0 && result < 0) || (left < 0 && right < 0 && result >= 0) {
+			return 0, errOverflow
+		}
+		return result, nil
+	case "-":
+		result := left - right
+		if (right > 0 && result > left) || (right < 0 && result < left) {
+			return 0, errOverflow
+		}
+		return result, nil
+	case "*":
+		result, ok := multiply(left, right)
+		if !ok {
+			return 0, errOverflow
+		}
+		return result, nil
+	case "/", "%":
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero: %d %s %d", left, operator, right)
+		}
+		if operator == "%" {
+			return left % right, nil
+		}
+		if left == math.MinInt64 && right == -1 {
+			return 0, errOverflow
+		}
+		return left / right, nil
+	case "**":
+		if right < 0 {
+			return 0, fmt.Errorf("negative exponent: %d ** %d", left, right)
+		}
+		result, ok := power(left, right)
+		if !ok {
+			return 0, errOverflow
+		}
+		return result, nil
+	case "<<":
+		if right < 0 {
+			return 0, fmt.Errorf("negative shift count: %d << %d", left, right)
+		}
+		if left == 0 {
+			return 0, nil
+		}
+		if right >= 64 || left<<right>>right != left {
+			return 0, errOverflow
+		}
+		return left << right, nil
+	case ">>":
+		if right < 0 {
+			return 0, fmt.Errorf("negative shift count: %d >> %d", left, right)
+		}
+		return left >> uint64(right), nil
+	case "&":
+		return left & right, nil
+	case "|":
+		return left | right, nil
+	case "^":
+		return left ^ right, nil
+	default:
+		return 0, ErrUnknownOperator
+	}
+}
+
+// bigInfix is IntegerInfix for operands or results that don't fit an int64.
+// It never modifies left or right, they may be the values of constants
+func bigInfix(operator string, left, right *big.Int) (Object, error) {
+	tooLarge := func() error {
+		return fmt.Errorf("integer too large: %s %s %s", left, operator, right)
+	}
+
+	result := new(big.Int)
+
+	switch operator {
+	case "+":
+		result.Add(left, right)
+	case "-":
+		result.Sub(left, right)
+	case "*":
+		result.Mul(left, right)
+	case "/", "%":
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero: %s %s %s", left, operator, right)
+		}
+		// Quo and Rem truncate, like / and % on int64
+		if operator == "%" {
+			result.Rem(left, right)
+		} else {
+			result.Quo(left, right)
+		}
+	case "**":
+		if right.Sign() < 0 {
+			return nil, fmt.Errorf("negative exponent: %s ** %s", left, right)
+		}
+		if left.CmpAbs(big.NewInt(1)) > 0 {
+			// Every multiplication adds about BitLen bits to the result
+			if !right.IsInt64() || right.Int64() > maxIntegerBits ||
+				int64(left.BitLen())*right.Int64() > maxIntegerBits {
+				return nil, tooLarge()
+			}
+		}
+		result.Exp(left, right, nil)
+	case "<<":
+		if right.Sign() < 0 {
+			return nil, fmt.Errorf("negative shift count: %s << %s", left, right)
+		}
+		if left.Sign() == 0 {
+			return &Integer{Value: 0}, nil
+		}
+		if !right.IsInt64() || int64(left.BitLen())+right.Int64() > maxIntegerBits {
+			return nil, tooLarge()
+		}
+		result.Lsh(left, uint(right.Int64()))
+	case ">>":
+		if right.Sign() < 0 {
+			return nil, fmt.Errorf("negative shift count: %s >> %s", left, right)
+		}
+		// Shifting by more than the length of left always gives 0 or -1
+		shift := uint(left.BitLen()) + 1
+		if right.IsInt64() && right.Int64() < int64(shift) {
+			shift = uint(right.Int64())
+		}
+		result.Rsh(left, shift)
+	case "&":
+		result.And(left, right)
+	case "|":
+		result.Or(left, right)
+	case "^":
+		result.Xor(left, right)
+	default:
+		return nil, ErrUnknownOperator
+	}
+
+	return IntegerFromBig(result), nil
+}
+
+// IntegerFromBig returns value as an *Integer when it fits an int64 and as
+// a *BigInteger otherwise
+func IntegerFromBig(value *big.Int) Object {
+	if value.IsInt64() {
+		return &Integer{Value: value.Int64()}
+	}
+	return &BigInteger{Value: value}
+}
+
+// NegateInteger is -value. Negating the smallest int64 gives a *BigInteger
+func NegateInteger(value Object) Object {
+	if integer, ok := value.(*Integer); ok && integer.Value != math.MinInt64 {
+		return &Integer{Value: -integer.Value}
+	}
+	return IntegerFromBig(new(big.Int).Neg(toBigInt(value)))
+}
+
+// ComplementInteger is ~value, the bitwise not
+func ComplementInteger(value Object) Object {
+	if integer, ok := value.(*Integer); ok {
+		return &Integer{Value: ^integer.Value}
+	}
+	return IntegerFromBig(new(big.Int).Not(toBigInt(value)))
+}
+
+// CompareIntegers returns -1, 0 or +1 as left is less than, equal to or
+// greater than right
+func CompareIntegers(left, right Object) int {
+	if l, ok := left.(*Integer); ok {
+		if r, ok := right.(*Integer); ok {
+			switch {
+			case l.Value < r.Value:
+				return -1
+			case l.Value > r.Value:
+				return 1
+			default:
+				return 0
+			}
+		}
+	}
+	return toBigInt(left).Cmp(toBigInt(right))
+}
+
+// toBigInt returns the value of an *Integer or a *BigInteger. The result
+// must not be modified, it may be the BigInteger's own value
+func toBigInt(obj Object) *big.Int {
+	if integer, ok := obj.(*Integer); ok {
+		return big.NewInt(integer.Value)
+	}
+	return obj.(*BigInteger).Value
+}
+
+func multiply(a, b int64) (int64, bool) {
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+	result := a * b
+	if result/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+	return result, true
+}
+
+// power computes base**exp by repeated squaring, stopping at the first
+// multiplication that overflows
+func power(base, exp int64) (int64, bool) {
+	result := int64(1)
+	for exp > 0 {
+		var ok bool
+		if exp&1 == 1 {
+			if result, ok = multiply(result, base); !ok {
+				return 0, false
+			}
+		}
+		exp >>= 1
+		if exp > 0 {
+			if base, ok = multiply(base, base); !ok {
+				return 0, false
+			}
+		}
+	}
+	return result, true
+}
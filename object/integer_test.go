@@ -0,0 +1,147 @@
+package object
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestIntegerInfix(t *testing.T) {
+	tests := []struct {
+		operator    string
+		left, right string
+		expected    string
+		err         string
+	}{
+		{"+", "9223372036854775807", "0", "9223372036854775807", ""},
+		{"+", "9223372036854775807", "1", "9223372036854775808", ""},
+		{"+", "-9223372036854775808", "-1", "-9223372036854775809", ""},
+		{"-", "-9223372036854775808", "1", "-9223372036854775809", ""},
+		{"-", "0", "-9223372036854775808", "9223372036854775808", ""},
+		{"-", "-1", "9223372036854775807", "-9223372036854775808", ""},
+		{"-", "9223372036854775808", "1", "9223372036854775807", ""},
+		{"*", "3037000499", "3037000499", "9223372030926249001", ""},
+		{"*", "3037000500", "3037000500", "9223372037000250000", ""},
+		{"*", "-1", "-9223372036854775808", "9223372036854775808", ""},
+		{"/", "-9223372036854775808", "-1", "9223372036854775808", ""},
+		{"/", "7", "0", "", "division by zero: 7 / 0"},
+		{"/", "100000000000000000000", "0", "", "division by zero: 100000000000000000000 / 0"},
+		{"/", "-100000000000000000000", "7", "-14285714285714285714", ""},
+		{"%", "-7", "2", "-1", ""},
+		{"%", "-100000000000000000000", "7", "-2", ""},
+		{"%", "7", "0", "", "division by zero: 7 % 0"},
+		{"**", "3", "0", "1", ""},
+		{"**", "-3", "3", "-27", ""},
+		{"**", "2", "63", "9223372036854775808", ""},
+		{"**", "-2", "63", "-9223372036854775808", ""},
+		{"**", "10", "30", "1000000000000000000000000000000", ""},
+		{"**", "1", "100000000000000000000", "1", ""},
+		{"**", "-1", "100000000000000000001", "-1", ""},
+		{"**", "2", "10000000000", "", "integer too large: 2 ** 10000000000"},
+		{"**", "2", "-1", "", "negative exponent: 2 ** -1"},
+		{"<<", "1", "62", "4611686018427387904", ""},
+		{"<<", "-1", "63", "-9223372036854775808", ""},
+		{"<<", "1", "64", "18446744073709551616", ""},
+		{"<<", "0", "100000000000000000000", "0", ""},
+		{"<<", "1", "100000000000000000000", "", "integer too large: 1 << 100000000000000000000"},
+		{"<<", "1", "-1", "", "negative shift count: 1 << -1"},
+		{">>", "-8", "1", "-4", ""},
+		{">>", "-8", "100", "-1", ""},
+		{">>", "18446744073709551616", "1", "9223372036854775808", ""},
+		{">>", "18446744073709551616", "2", "4611686018427387904", ""},
+		{">>", "-18446744073709551616", "100000000000000000000", "-1", ""},
+		{">>", "1", "-1", "", "negative shift count: 1 >> -1"},
+		{"&", "12", "10", "8", ""},
+		{"|", "12", "10", "14", ""},
+		{"^", "12", "10", "6", ""},
+		{"&", "-18446744073709551616", "18446744073709551615", "0", ""},
+		{"|", "18446744073709551616", "1", "18446744073709551617", ""},
+	}
+
+	for _, tt := range tests {
+		result, err := IntegerInfix(tt.operator, integer(tt.left), integer(tt.right))
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("%s %s %s: expected error %q, got %v", tt.left, tt.operator, tt.right, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s %s: unexpected error %s", tt.left, tt.operator, tt.right, err)
+			continue
+		}
+		testIntegerResult(t, tt.left+" "+tt.operator+" "+tt.right, result, tt.expected)
+	}
+
+	if _, err := IntegerInfix("<", integer("1"), integer("2")); !errors.Is(err, ErrUnknownOperator) {
+		t.Errorf("expected ErrUnknownOperator for <, got %v", err)
+	}
+}
+
+func TestIntegerPrefix(t *testing.T) {
+	tests := []struct {
+		operator string
+		value    string
+		expected string
+	}{
+		{"-", "5", "-5"},
+		{"-", "-9223372036854775808", "9223372036854775808"},
+		{"-", "9223372036854775808", "-9223372036854775808"},
+		{"~", "5", "-6"},
+		{"~", "9223372036854775807", "-9223372036854775808"},
+		{"~", "-9223372036854775809", "9223372036854775808"},
+	}
+
+	for _, tt := range tests {
+		var result Object
+		if tt.operator == "-" {
+			result = NegateInteger(integer(tt.value))
+		} else {
+			result = ComplementInteger(integer(tt.value))
+		}
+		testIntegerResult(t, tt.operator+tt.value, result, tt.expected)
+	}
+}
+
+func TestCompareIntegers(t *testing.T) {
+	tests := []struct {
+		left, right string
+		expected    int
+	}{
+		{"1", "2", -1},
+		{"2", "2", 0},
+		{"9223372036854775808", "9223372036854775807", 1},
+		{"-9223372036854775809", "-9223372036854775808", -1},
+		{"100000000000000000000", "100000000000000000000", 0},
+	}
+
+	for _, tt := range tests {
+		if got := CompareIntegers(integer(tt.left), integer(tt.right)); got != tt.expected {
+			t.Errorf("CompareIntegers(%s, %s) wrong. want=%d, got=%d", tt.left, tt.right, tt.expected, got)
+		}
+	}
+}
+
+// integer parses s into an *Integer or, when it doesn't fit, a *BigInteger
+func integer(s string) Object {
+	value, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("bad integer in test: " + s)
+	}
+	return IntegerFromBig(value)
+}
+
+// testIntegerResult checks the value of result, and that it is only a
+// *BigInteger when it has to be
+func testIntegerResult(t *testing.T, input string, result Object, expected string) {
+	t.Helper()
+
+	if result.Inspect() != expected {
+		t.Errorf("%s: wrong result. want=%s, got=%s", input, expected, result.Inspect())
+	}
+
+	_, isBig := result.(*BigInteger)
+	if _, wantBig := integer(expected).(*BigInteger); isBig != wantBig {
+		t.Errorf("%s: wrong representation for %s, got %T", input, expected, result)
+	}
+}
@@ -1,15 +1,34 @@
 package object
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+	"galexw/monkey/ast"
+	"galexw/monkey/code"
+	"galexw/monkey/token"
+	"hash/fnv"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	FLOAT_OBJ        = "FLOAT"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
 	ERROR_OBJ        = "ERROR"
+	FUNCTION_OBJ     = "FUNCTION"
+	STRING_OBJ       = "STRING"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	BUILTIN_OBJ      = "BUILTIN"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	CELL_OBJ              = "CELL"
 )
 
 type Object interface {
@@ -17,6 +36,18 @@ type Object interface {
 	Inspect() string
 }
 
+// HashKey is what a hash is actually keyed by. Two objects with the same
+// value produce the same HashKey even though they are different pointers
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+// Hashable is implemented by the objects that can be used as hash keys
+type Hashable interface {
+	HashKey() HashKey
+}
+
 type Integer struct {
 	Value int64
 }
@@ -29,6 +60,107 @@ func (i *Integer) Inspect() string {
 	return fmt.Sprintf("%d", i.Value)
 }
 
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+// BigInteger is an integer that doesn't fit an int64. It has the same
+// INTEGER type as Integer, and arithmetic switches between the two as values
+// grow and shrink, so Monkey code can't tell them apart
+type BigInteger struct {
+	Value *big.Int
+}
+
+func (bi *BigInteger) Type() ObjectType {
+	return INTEGER_OBJ
+}
+
+func (bi *BigInteger) Inspect() string {
+	return bi.Value.String()
+}
+
+// bigIntegerKey is the HashKey type of big integers. A BigInteger never holds
+// a value that fits an Integer, so the two can't be equal, but the hash of
+// its digits could equal some int64 if they shared the INTEGER type
+const bigIntegerKey ObjectType = "BIG_INTEGER"
+
+func (bi *BigInteger) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(bi.Value.String()))
+
+	return HashKey{Type: bigIntegerKey, Value: h.Sum64()}
+}
+
+type Float struct {
+	Value float64
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
+func (f *Float) Inspect() string {
+	return formatFloat(f.Value)
+}
+
+type String struct {
+	Value string
+
+	length int // the rune count plus one, once Length has counted it
+}
+
+func (s *String) Type() ObjectType {
+	return STRING_OBJ
+}
+
+func (s *String) Inspect() string {
+	return s.Value
+}
+
+// Length is the number of characters in the string, which is what len
+// returns. A character is a rune, so "é" has length 1 even though it takes
+// two bytes
+func (s *String) Length() int {
+	if s.length == 0 {
+		s.length = utf8.RuneCountInString(s.Value) + 1
+	}
+	return s.length - 1
+}
+
+// Index returns the character at index i as a string, counting negative
+// indexes back from the end like arrays do. It returns nil when i is out of
+// range
+func (s *String) Index(i int64) *String {
+	length := int64(s.Length())
+
+	if i < 0 {
+		i += length
+	}
+	if i < 0 || i >= length {
+		return nil
+	}
+
+	// Every character is a byte when there are as many runes as bytes
+	if length == int64(len(s.Value)) {
+		return &String{Value: s.Value[i : i+1]}
+	}
+
+	rest := s.Value
+	for ; i > 0; i-- {
+		_, size := utf8.DecodeRuneInString(rest)
+		rest = rest[size:]
+	}
+	_, size := utf8.DecodeRuneInString(rest)
+	return &String{Value: rest[:size]}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -41,6 +173,15 @@ func (b *Boolean) Inspect() string {
 	return fmt.Sprintf("%t", b.Value)
 }
 
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+
+	return HashKey{Type: b.Type(), Value: value}
+}
+
 type Null struct{}
 
 func (n *Null) Type() ObjectType {
@@ -66,7 +207,8 @@ func (rv *ReturnValue) Inspect() string {
 }
 
 type Error struct {
-	Message string
+	Message  string
+	Position token.Position // Where in the source the error was raised
 }
 
 func (e *Error) Type() ObjectType {
@@ -74,5 +216,173 @@ func (e *Error) Type() ObjectType {
 }
 
 func (e *Error) Inspect() string {
+	if e.Position.IsValid() {
+		return "ERROR: " + e.Position.String() + ": " + e.Message
+	}
 	return "ERROR: " + e.Message
 }
+
+// Function keeps hold of the environment it was defined in, which is what
+// lets closures see the bindings that were around when they were created
+type Function struct {
+	Parameters []*ast.Identifier
+	Body       *ast.Block
+	Env        *Environment
+}
+
+func (f *Function) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Body.String())
+	out.WriteString("\n}")
+
+	return out.String()
+}
+
+type BuiltinFunction func(args ...Object) Object
+
+// Builtin wraps a Go function so it can be called from Monkey like any other
+// function value
+type Builtin struct {
+	Fn BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType {
+	return BUILTIN_OBJ
+}
+
+func (b *Builtin) Inspect() string {
+	return "builtin function"
+}
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType {
+	return ARRAY_OBJ
+}
+
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// HashPair keeps the original key object around so the hash can still be
+// printed, since HashKey alone can't be turned back into a value
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey // in the order they were added, which is how the hash prints
+}
+
+// Set adds a pair to the hash. A key that is already there keeps its place
+// and gets the new pair
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if h.Pairs == nil {
+		h.Pairs = make(map[HashKey]HashPair)
+	}
+	if _, ok := h.Pairs[key]; !ok {
+		h.Keys = append(h.Keys, key)
+	}
+	h.Pairs[key] = pair
+}
+
+func (h *Hash) Type() ObjectType {
+	return HASH_OBJ
+}
+
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, key := range h.Keys {
+		pair := h.Pairs[key]
+		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// CompiledFunction is a function body turned into bytecode by the compiler.
+// It only exists in the constant pool; at runtime it is always wrapped in
+// a Closure
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	NumLocals     int
+	NumParameters int
+	Lines         code.LineTable
+	LocalNames    []string // the names of the locals, by slot
+	FreeNames     []string // the names of the free variables, by index
+}
+
+func (cf *CompiledFunction) Type() ObjectType {
+	return COMPILED_FUNCTION_OBJ
+}
+
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Closure is the VM's function value: the compiled function plus the free
+// variables it captured when it was created. It reports itself as a
+// FUNCTION so programs can't tell which engine runs them
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Cell
+}
+
+func (c *Closure) Type() ObjectType {
+	return FUNCTION_OBJ
+}
+
+func (c *Closure) Inspect() string {
+	return fmt.Sprintf("Closure[%p]", c)
+}
+
+// Cell holds a variable captured by a closure. The VM moves a local into a
+// cell when a closure captures it, and the function and the closure share
+// the cell from then on, so a later let of the variable is seen by both,
+// the same as when the evaluator's closures look the name up in their scope
+type Cell struct {
+	Value Object
+}
+
+func (c *Cell) Type() ObjectType {
+	return CELL_OBJ
+}
+
+func (c *Cell) Inspect() string {
+	return fmt.Sprintf("Cell[%p]", c)
+}
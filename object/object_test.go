@@ -0,0 +1,105 @@
+package object
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestStringIndex(t *testing.T) {
+	str := &String{Value: "héllo 😀"}
+
+	if str.Length() != 7 {
+		t.Errorf("Length() wrong. want=7, got=%d", str.Length())
+	}
+
+	tests := []struct {
+		index    int64
+		expected string // "" for out of range
+	}{
+		{0, "h"},
+		{1, "é"},
+		{6, "😀"},
+		{-1, "😀"},
+		{-7, "h"},
+		{7, ""},
+		{-8, ""},
+	}
+
+	for _, tt := range tests {
+		ch := str.Index(tt.index)
+		if tt.expected == "" {
+			if ch != nil {
+				t.Errorf("Index(%d) wrong. want=nil, got=%q", tt.index, ch.Value)
+			}
+			continue
+		}
+		if ch == nil || ch.Value != tt.expected {
+			t.Errorf("Index(%d) wrong. want=%q, got=%v", tt.index, tt.expected, ch)
+		}
+	}
+
+	ascii := &String{Value: "hello"}
+	if ch := ascii.Index(1); ch == nil || ch.Value != "e" {
+		t.Errorf("Index(1) of %q wrong. want=%q, got=%v", ascii.Value, "e", ch)
+	}
+	if ch := ascii.Index(-1); ch == nil || ch.Value != "o" {
+		t.Errorf("Index(-1) of %q wrong. want=%q, got=%v", ascii.Value, "o", ch)
+	}
+	if ascii.Length() != 5 {
+		t.Errorf("Length() of %q wrong. want=5, got=%d", ascii.Value, ascii.Length())
+	}
+}
+
+func TestBigIntegerHashKey(t *testing.T) {
+	huge := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 64)}
+	same := &BigInteger{Value: new(big.Int).Lsh(big.NewInt(1), 64)}
+	// The fnv hash of "18446744073709551616", as an int64
+	collision := &Integer{Value: -1300789964862373523}
+
+	if huge.HashKey() != same.HashKey() {
+		t.Errorf("equal big integers have different hash keys")
+	}
+	if huge.HashKey() == collision.HashKey() {
+		t.Errorf("2**64 and %d have the same hash key", collision.Value)
+	}
+}
+
+func TestHashKeysDifferByType(t *testing.T) {
+	one := &Integer{Value: 1}
+	yes := &Boolean{Value: true}
+
+	if one.HashKey() == yes.HashKey() {
+		t.Errorf("integer 1 and true have the same hash key")
+	}
+}
+
+func TestHashKeepsInsertionOrder(t *testing.T) {
+	hash := &Hash{}
+	for i, key := range []string{"b", "a", "b"} {
+		str := &String{Value: key}
+		hash.Set(str.HashKey(), HashPair{Key: str, Value: &Integer{Value: int64(i)}})
+	}
+
+	if inspect := hash.Inspect(); inspect != "{b: 2, a: 1}" {
+		t.Errorf("Inspect wrong. want=%q, got=%q", "{b: 2, a: 1}", inspect)
+	}
+}
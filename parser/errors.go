@@ -0,0 +1,85 @@
+package parser
+
+import (
+	"fmt"
+	"galexw/monkey/token"
+	"strings"
+)
+
+type ErrorKind int
+
+const (
+	UnexpectedToken ErrorKind = iota // expected one token, found another
+	NoPrefixParseFn                  // token can't start an expression
+	InvalidInteger                   // integer literal doesn't fit or is malformed
+	InvalidFloat                     // float literal is out of range
+	IllegalToken                     // the lexer couldn't make a token, like an unterminated comment
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case UnexpectedToken:
+		return "UnexpectedToken"
+	case NoPrefixParseFn:
+		return "NoPrefixParseFn"
+	case InvalidInteger:
+		return "InvalidInteger"
+	case InvalidFloat:
+		return "InvalidFloat"
+	case IllegalToken:
+		return "IllegalToken"
+	default:
+		return fmt.Sprintf("ErrorKind(%d)", int(k))
+	}
+}
+
+// ParseError describes a single problem found while parsing. Expected is
+// only set for UnexpectedToken errors
+type ParseError struct {
+	Kind     ErrorKind
+	Expected token.TokenType
+	Actual   token.Token
+	Position token.Position
+	Message  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Position, e.Message)
+}
+
+// Format renders the error followed by the offending line of source with a
+// caret under the position, which is what the REPL prints
+func (e *ParseError) Format(source string) string {
+	if snippet := token.Highlight(source, e.Position); snippet != "" {
+		return e.Error() + "\n" + snippet
+	}
+	return e.Error()
+}
+
+// ErrorList is the error returned by ParseProgram. It holds every error
+// found, in the order they were found
+type ErrorList []*ParseError
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+
+	messages := make([]string, len(l))
+	for i, err := range l {
+		messages[i] = err.Error()
+	}
+	return fmt.Sprintf("%d parse errors:\n%s", len(l), strings.Join(messages, "\n"))
+}
+
+// Unwrap lets errors.As reach the individual ParseErrors
+func (l ErrorList) Unwrap() []error {
+	errs := make([]error, len(l))
+	for i, err := range l {
+		errs[i] = err
+	}
+	return errs
+}
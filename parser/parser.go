@@ -1,10 +1,12 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"galexw/monkey/ast"
 	"galexw/monkey/lexer"
 	"galexw/monkey/token"
+	"math/big"
 	"strconv"
 )
 
@@ -16,19 +18,32 @@ type (
 const (
 	_ int = iota
 	LOWEST
+	LOGICALOR   // ||
+	LOGICALAND  // &&
 	EQUALS      // ==
 	LESSGREATER // > or <
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
+	SHIFT       // << or >>
 	SUM         // +
 	PRODUCT     // *
 	PREFIX      // -X or !X
+	POWER       // ** binds tighter than a prefix on its left: -2 ** 2 is -(2 ** 2)
 	CALL        // myFunction(X)
+	INDEX       // array[index]
 )
 
 type Parser struct {
 	lexer     *lexer.Lexer
 	curToken  token.Token
 	peekToken token.Token
-	errors    []string
+	errors    ErrorList
+	comments  []*ast.Comment
+
+	// Number of { opened and not yet closed, counting curToken. Used to
+	// find where the enclosing block ends when recovering from an error
+	braceDepth int
 
 	// As of now - I do not understand what's the point of these maps of token
 	// types to functions. I'll probably understand it when I get to the
@@ -38,15 +53,27 @@ type Parser struct {
 }
 
 var precedences = map[token.TokenType]int{
-	token.EQUAL:       EQUALS,
-	token.NOTEQUAL:    EQUALS,
-	token.LESSTHAN:    LESSGREATER,
-	token.GREATERTHAN: LESSGREATER,
-	token.PLUS:        SUM,
-	token.MINUS:       SUM,
-	token.SLASH:       PRODUCT,
-	token.ASTERISK:    PRODUCT,
-	token.LEFTPAREN:   CALL,
+	token.OR:           LOGICALOR,
+	token.AND:          LOGICALAND,
+	token.EQUAL:        EQUALS,
+	token.NOTEQUAL:     EQUALS,
+	token.LESSTHAN:     LESSGREATER,
+	token.GREATERTHAN:  LESSGREATER,
+	token.LESSEQUAL:    LESSGREATER,
+	token.GREATEREQUAL: LESSGREATER,
+	token.PIPE:         BITOR,
+	token.CARET:        BITXOR,
+	token.AMPERSAND:    BITAND,
+	token.SHIFTLEFT:    SHIFT,
+	token.SHIFTRIGHT:   SHIFT,
+	token.PLUS:         SUM,
+	token.MINUS:        SUM,
+	token.SLASH:        PRODUCT,
+	token.ASTERISK:     PRODUCT,
+	token.PERCENT:      PRODUCT,
+	token.POWER:        POWER,
+	token.LEFTPAREN:    CALL,
+	token.LEFTBRACKET:  INDEX,
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -63,13 +90,18 @@ func New(l *lexer.Lexer) *Parser {
 	// prefix parse functions at the moment
 	p.registerPrefix(token.IDENTIFIER, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+	p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
 	p.registerPrefix(token.LEFTPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.LEFTBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LEFTBRACE, p.parseHashLiteral)
 
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
@@ -80,36 +112,114 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NOTEQUAL, p.parseInfixExpression)
 	p.registerInfix(token.LESSTHAN, p.parseInfixExpression)
 	p.registerInfix(token.GREATERTHAN, p.parseInfixExpression)
+	p.registerInfix(token.LESSEQUAL, p.parseInfixExpression)
+	p.registerInfix(token.GREATEREQUAL, p.parseInfixExpression)
+	p.registerInfix(token.PERCENT, p.parseInfixExpression)
+	p.registerInfix(token.POWER, p.parseInfixExpression)
+	p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+	p.registerInfix(token.PIPE, p.parseInfixExpression)
+	p.registerInfix(token.CARET, p.parseInfixExpression)
+	p.registerInfix(token.SHIFTLEFT, p.parseInfixExpression)
+	p.registerInfix(token.SHIFTRIGHT, p.parseInfixExpression)
+	p.registerInfix(token.AND, p.parseInfixExpression)
+	p.registerInfix(token.OR, p.parseInfixExpression)
 
 	// This is really cool
 	p.registerInfix(token.LEFTPAREN, p.parseCallExpression)
+	p.registerInfix(token.LEFTBRACKET, p.parseIndexExpression)
 
 	return p
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() ErrorList {
 	return p.errors
 }
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
 	p.peekToken = p.lexer.NextToken()
+
+	// Comments only show up here when the lexer keeps them
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, &ast.Comment{Token: p.peekToken})
+		p.peekToken = p.lexer.NextToken()
+	}
+
+	switch p.curToken.Type {
+	case token.LEFTBRACE:
+		p.braceDepth++
+	case token.RIGHTBRACE:
+		if p.braceDepth > 0 {
+			p.braceDepth--
+		}
+	}
 }
 
-func (p *Parser) ParseProgram() *ast.Program {
+// ParseProgram parses the whole input. The program is returned even when
+// there are errors, and the error is always an ErrorList
+func (p *Parser) ParseProgram() (*ast.Program, error) {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
 	for p.curToken.Type != token.EOF {
-		stmt := p.parseStatement()
-		program.Statements = append(program.Statements, stmt)
+		if stmt := p.parseStatementOrRecover(0); stmt != nil {
+			program.Statements = append(program.Statements, stmt)
+		}
 
 		// Need to organize where to end a statement
 		// Some statements end with a semicolon, some don't
 		p.nextToken()
 	}
+	program.Comments = p.comments
 
-	return program
+	if len(p.errors) > 0 {
+		return program, p.errors
+	}
+
+	return program, nil
+}
+
+// bailout is panicked with when an error is recorded, unwinding the parse
+// back to the statement that contained the error
+type bailout struct{}
+
+// parseStatementOrRecover parses a statement at the given brace depth. If
+// the statement has an error, it skips ahead to where the next statement
+// can start and returns nil, so one mistake only produces one error
+func (p *Parser) parseStatementOrRecover(depth int) (stmt ast.Statement) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(bailout); !ok {
+				panic(r)
+			}
+			stmt = nil
+			p.synchronize(depth)
+		}
+	}()
+
+	return p.parseStatement()
+}
+
+// synchronize skips tokens until curToken is the last token of the broken
+// statement: a ; or the token before let, return, fn or the } closing the
+// block at depth. Braces opened inside the broken statement are skipped
+// over whole. If the closing } itself was already consumed, it stays as
+// curToken so the block can see it
+func (p *Parser) synchronize(depth int) {
+	for !p.curTokenIs(token.EOF) && p.braceDepth >= depth {
+		if p.braceDepth == depth {
+			if p.curTokenIs(token.SEMICOLON) {
+				return
+			}
+
+			switch p.peekToken.Type {
+			case token.LET, token.RETURN, token.FUNCTION, token.RIGHTBRACE, token.EOF:
+				return
+			}
+		}
+
+		p.nextToken()
+	}
 }
 
 func (p *Parser) parseStatement() ast.Statement {
@@ -209,12 +319,20 @@ func (p *Parser) parseBlock() *ast.Block {
 		Token: p.curToken,
 	}
 	block.Statements = []ast.Statement{}
+	depth := p.braceDepth
 
 	p.nextToken()
 
 	for !p.curTokenIs(token.RIGHTBRACE) && !p.curTokenIs(token.EOF) {
-		stmt := p.parseStatement()
-		block.Statements = append(block.Statements, stmt)
+		if stmt := p.parseStatementOrRecover(depth); stmt != nil {
+			block.Statements = append(block.Statements, stmt)
+		}
+
+		// Recovery stopped on the } that closes this block
+		if p.braceDepth < depth {
+			break
+		}
+
 		p.nextToken()
 	}
 
@@ -232,16 +350,50 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	itl := &ast.IntegerLiteral{Token: p.curToken}
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		// Too big for an int64, the evaluator and the VM use a big integer
+		if value, ok := new(big.Int).SetString(p.curToken.Literal, 0); ok {
+			itl.Big = value
+			return itl
+		}
+	}
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
-		return nil
+		p.fail(&ParseError{
+			Kind:     InvalidInteger,
+			Actual:   p.curToken,
+			Position: p.curToken.Position,
+			Message:  fmt.Sprintf("could not parse %q as integer", p.curToken.Literal),
+		})
 	}
 
 	itl.Value = value
 	return itl
 }
 
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	fl := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.fail(&ParseError{
+			Kind:     InvalidFloat,
+			Actual:   p.curToken,
+			Position: p.curToken.Position,
+			Message:  fmt.Sprintf("could not parse %q as float", p.curToken.Literal),
+		})
+	}
+
+	fl.Value = value
+	return fl
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{
+		Token: p.curToken,
+		Value: p.curToken.Literal,
+	}
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{
 		Token: p.curToken,
@@ -285,6 +437,11 @@ func (p *Parser) parseInfixExpression(leftExpression ast.Expression) ast.Express
 	}
 
 	precedence := p.curPrecedence()
+	if ie.Operator == "**" {
+		// Parsing the right side one level lower lets it take in another **,
+		// which makes ** right associative: 2 ** 3 ** 2 is 2 ** (3 ** 2)
+		precedence--
+	}
 
 	p.nextToken()
 
@@ -317,7 +474,11 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	expression := p.parseExpression(LOWEST)
 	letStatement.Value = expression
 
-	for !p.curTokenIs(token.SEMICOLON) {
+	if fl, ok := expression.(*ast.FunctionLiteral); ok {
+		fl.Name = letStatement.Name.Value
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -333,8 +494,8 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	returnStatement.ReturnValue = p.parseExpression(LOWEST)
 
-	if !p.expectPeek(token.SEMICOLON) {
-		return nil
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
 	}
 
 	return returnStatement
@@ -398,37 +559,90 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 }
 
 func (p *Parser) parseCallExpression(leftExpression ast.Expression) ast.Expression {
-	return &ast.CallExpression{
-		Token:     p.curToken,
-		Function:  leftExpression, // This is the identifier for the function
-		Arguments: p.parseCallArguments(),
+	call := &ast.CallExpression{
+		Token:    p.curToken,
+		Function: leftExpression, // This is the identifier for the function
 	}
+	call.Arguments = p.parseExpressionList(token.RIGHTPAREN)
+	return call
 }
 
-func (p *Parser) parseCallArguments() []ast.Expression {
-	arguments := []ast.Expression{}
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RIGHTBRACKET)
+	return array
+}
 
-	if p.peekTokenIs(token.RIGHTPAREN) {
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RIGHTBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RIGHTBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RIGHTBRACE) {
+		return nil
+	}
+
+	return hash
+}
+
+func (p *Parser) parseIndexExpression(leftExpression ast.Expression) ast.Expression {
+	ie := &ast.IndexExpression{
+		Token: p.curToken,
+		Left:  leftExpression,
+	}
+
+	p.nextToken()
+	ie.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.RIGHTBRACKET) {
+		return nil
+	}
+
+	return ie
+}
+
+// parseExpressionList parses comma separated expressions up to the end
+// token, which is how both call arguments and array elements are written
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
 		p.nextToken()
-		return arguments
+		return list
 	}
 
 	p.nextToken()
 
-	arguments = append(arguments, p.parseExpression(LOWEST))
+	list = append(list, p.parseExpression(LOWEST))
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
 
-		arguments = append(arguments, p.parseExpression(LOWEST))
+		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(token.RIGHTPAREN) {
+	if !p.expectPeek(end) {
 		return nil
 	}
 
-	return arguments
+	return list
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -472,9 +686,45 @@ func (p *Parser) peekPrecedence() int {
 }
 
 func (p *Parser) peekError(expectedTokenType token.TokenType) {
-	p.errors = append(p.errors, fmt.Sprintf("Expected token %s, got %s", expectedTokenType, p.peekToken.Type))
+	if p.peekTokenIs(token.ILLEGAL) {
+		p.illegalTokenError(p.peekToken)
+	}
+
+	p.fail(&ParseError{
+		Kind:     UnexpectedToken,
+		Expected: expectedTokenType,
+		Actual:   p.peekToken,
+		Position: p.peekToken.Position,
+		Message:  fmt.Sprintf("Expected token %s, got %s", expectedTokenType, p.peekToken.Type),
+	})
+}
+
+// fail records err and abandons the current statement
+func (p *Parser) fail(err *ParseError) {
+	p.errors = append(p.errors, err)
+	panic(bailout{})
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	p.errors = append(p.errors, fmt.Sprintf("No prefix parse function for token %s", t))
+	if t == token.ILLEGAL {
+		p.illegalTokenError(p.curToken)
+	}
+
+	p.fail(&ParseError{
+		Kind:     NoPrefixParseFn,
+		Actual:   p.curToken,
+		Position: p.curToken.Position,
+		Message:  fmt.Sprintf("No prefix parse function for token %s", t),
+	})
+}
+
+// illegalTokenError reports a token the lexer couldn't make sense of, with
+// the lexer's explanation rather than a complaint about the grammar
+func (p *Parser) illegalTokenError(tok token.Token) {
+	p.fail(&ParseError{
+		Kind:     IllegalToken,
+		Actual:   tok,
+		Position: tok.Position,
+		Message:  lexer.IllegalReason(tok),
+	})
 }
@@ -1,9 +1,11 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"galexw/monkey/ast"
 	"galexw/monkey/lexer"
+	"galexw/monkey/token"
 	"testing"
 )
 
@@ -22,8 +24,8 @@ func TestLetStatements(t *testing.T) {
 		l := lexer.New(tt.input)
 		p := New(l)
 
-		program := p.ParseProgram()
-		checkParserErrors(t, p)
+		program, err := p.ParseProgram()
+		checkParserErrors(t, err)
 
 		if len(program.Statements) != 1 {
 			t.Fatalf("program.Statements does not contain 1 statement. Got %d", len(program.Statements))
@@ -50,10 +52,198 @@ func TestFailLetStatements(t *testing.T) {
 	l := lexer.New(input)
 	p := New(l)
 
-	p.ParseProgram()
-	if len(p.Errors()) == 0 {
+	_, err := p.ParseProgram()
+	if err == nil {
 		t.Fatalf("ParseProgram() should have returned errors")
 	}
+
+	if len(p.Errors()) != 3 {
+		t.Errorf("expected one error per broken statement. Got %d: %v", len(p.Errors()), p.Errors())
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	input := "let x = 5;\nlet y = (1 + 2;"
+	l := lexer.NewFile("test.mk", input)
+	p := New(l)
+
+	p.ParseProgram()
+	errs := p.Errors()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(errs), errs)
+	}
+
+	expected := "test.mk:2:15: Expected token ), got ;\nlet y = (1 + 2;\n              ^"
+	if errs[0].Format(input) != expected {
+		t.Errorf("wrong error. expected=%q, got=%q", expected, errs[0].Format(input))
+	}
+}
+
+func TestStructuredErrors(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedKind     ErrorKind
+		expectedExpected token.TokenType
+		expectedActual   token.TokenType
+		expectedLine     int
+		expectedColumn   int
+	}{
+		{"let = 5;", UnexpectedToken, token.IDENTIFIER, token.ASSIGN, 1, 5},
+		{"let x 5;", UnexpectedToken, token.ASSIGN, token.INT, 1, 7},
+		{"add(1, 2", UnexpectedToken, token.RIGHTPAREN, token.EOF, 1, 9},
+		{"\n  * 5", NoPrefixParseFn, "", token.ASTERISK, 2, 3},
+		{"1 + 09", IllegalToken, "", token.ILLEGAL, 1, 5},
+		{"1 + 1e999", InvalidFloat, "", token.FLOAT, 1, 5},
+		{"1 + /* open", IllegalToken, "", token.ILLEGAL, 1, 5},
+		{"let x /* open", IllegalToken, "", token.ILLEGAL, 1, 7},
+		{"5 # 5", IllegalToken, "", token.ILLEGAL, 1, 3},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		_, err := p.ParseProgram()
+
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("%q: error is not a *ParseError. Got %T", tt.input, err)
+			continue
+		}
+
+		if parseErr.Kind != tt.expectedKind {
+			t.Errorf("%q: wrong kind. expected=%s, got=%s", tt.input, tt.expectedKind, parseErr.Kind)
+		}
+		if parseErr.Expected != tt.expectedExpected {
+			t.Errorf("%q: wrong expected token. expected=%q, got=%q", tt.input, tt.expectedExpected, parseErr.Expected)
+		}
+		if parseErr.Actual.Type != tt.expectedActual {
+			t.Errorf("%q: wrong actual token. expected=%q, got=%q", tt.input, tt.expectedActual, parseErr.Actual.Type)
+		}
+		if parseErr.Position.Line != tt.expectedLine || parseErr.Position.Column != tt.expectedColumn {
+			t.Errorf("%q: wrong position. expected=%d:%d, got=%s", tt.input, tt.expectedLine, tt.expectedColumn, parseErr.Position)
+		}
+	}
+}
+
+func TestIllegalTokenMessages(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; /* open", "1:12: Unterminated block comment"},
+		{"let x = #;", "1:9: Illegal character \"#\""},
+		{"let x = 0x;", "1:9: Hexadecimal literal 0x has no digits"},
+		{"let x =\n  1__0;", "2:3: Underscores must be between digits in 1__0"},
+		{"0b102", "1:1: Invalid digit '2' in binary literal 0b102"},
+		{"1 + 12ab", "1:5: Invalid character 'a' in number 12ab"},
+		{"1e+", "1:1: Exponent has no digits in 1e+"},
+		{"0758", "1:1: Invalid digit '8' in octal literal 0758"},
+		{"let café = €;", "1:12: Illegal character \"€\""},
+		{"let x = \xff;", "1:9: Invalid UTF-8 byte \"\\xff\""},
+		{"12é", "1:1: Invalid character 'é' in number 12é"},
+		{"0x1ü", "1:1: Invalid digit 'ü' in hexadecimal literal 0x1ü"},
+		{`let s = "abc`, "1:9: Unterminated string"},
+		{`let s = "abc\";`, "1:9: Unterminated string"},
+		{"let s = `one\ntwo", "1:9: Unterminated raw string"},
+		{`puts("a\qb")`, "1:6: Unknown escape sequence \\q in string"},
+		{`"\u{D800}"`, "1:1: Invalid unicode escape in string, expected \\u{...} with 1 to 6 hex digits of a code point"},
+	}
+
+	for _, tt := range tests {
+		_, err := New(lexer.New(tt.input)).ParseProgram()
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%q: wrong error. expected=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 1; /* trailing */
+x /* inside */ + 2 // the end`
+
+	l := lexer.New(input)
+	l.KeepComments()
+	program, err := New(l).ParseProgram()
+	checkParserErrors(t, err)
+
+	if program.String() != "let x = 1;(x + 2);" {
+		t.Errorf("comments changed the program. got=%q", program.String())
+	}
+
+	expected := []string{"// leading", "/* trailing */", "/* inside */", "// the end"}
+	if len(program.Comments) != len(expected) {
+		t.Fatalf("wrong number of comments. expected=%d, got=%d", len(expected), len(program.Comments))
+	}
+	for i, text := range expected {
+		if program.Comments[i].String() != text {
+			t.Errorf("comment %d wrong. expected=%q, got=%q", i, text, program.Comments[i].String())
+		}
+	}
+	if pos := program.Comments[2].Pos(); pos.Line != 3 || pos.Column != 3 {
+		t.Errorf("wrong position for %q: %s", expected[2], pos)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string // positions of the errors, in order
+		expectedOutput string   // the statements that survived
+	}{
+		{"let x 5; let y = 10; y;", []string{"1:7"}, "let y = 10;y;"},
+		{"let = 10; let z = 5;", []string{"1:5"}, "let z = 5;"},
+		{"let x = (1 + ; let y = 2;", []string{"1:14"}, "let y = 2;"},
+		{"let x = 1 let y = 2", []string{}, "let x = 1;let y = 2;"},
+		{"let x = * 2\nlet y = 2;", []string{"1:9"}, "let y = 2;"},
+		{"if (a b) { 1 }; let y = 2;", []string{"1:7"}, "let y = 2;"},
+		{"if (a b) { {1: 2} }\nreturn 3;", []string{"1:7"}, "return 3;"},
+		{"let f = fn(x) { let = 1; x }; let y = 2;", []string{"1:21"}, "let f = fn(x) {x;};let y = 2;"},
+		{"let f = fn() { 1 + }; f;", []string{"1:20"}, "let f = fn() {};f;"},
+		{"let f = fn() { let a = ; a }; f;", []string{"1:24"}, "let f = fn() {a;};f;"},
+		{"let f = fn() { if (x { 1 } }; f;", []string{"1:22"}, "let f = fn() {};f;"},
+		{"let a = ]; let b = );", []string{"1:9", "1:20"}, ""},
+		{"}; let y = 2;", []string{"1:1"}, "let y = 2;"},
+		{"let x = [1, 2", []string{"1:14"}, ""},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program, _ := p.ParseProgram()
+
+		errs := p.Errors()
+		if len(errs) != len(tt.expectedErrors) {
+			t.Errorf("%q: expected %d errors. Got %d: %v", tt.input, len(tt.expectedErrors), len(errs), errs)
+			continue
+		}
+
+		for i, pos := range tt.expectedErrors {
+			if errs[i].Position.String() != pos {
+				t.Errorf("%q: errors[%d] at wrong position. expected=%s, got=%s", tt.input, i, pos, errs[i].Position)
+			}
+		}
+
+		if program.String() != tt.expectedOutput {
+			t.Errorf("%q: wrong program after recovery. expected=%q, got=%q", tt.input, tt.expectedOutput, program.String())
+		}
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	p := New(lexer.New("let = 1; let y 2;"))
+	_, err := p.ParseProgram()
+
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("error is not an ErrorList. Got %T", err)
+	}
+
+	if len(errs) != len(p.Errors()) {
+		t.Errorf("ErrorList has %d errors, Errors() has %d", len(errs), len(p.Errors()))
+	}
+
+	if _, err := New(lexer.New("let x = 1;")).ParseProgram(); err != nil {
+		t.Errorf("expected nil error for valid input. Got %v", err)
+	}
 }
 
 func TestReturnStatements(t *testing.T) {
@@ -65,8 +255,8 @@ func TestReturnStatements(t *testing.T) {
 	l := lexer.New(input)
 	p := New(l)
 
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
 	if program == nil {
 		t.Fatalf("ParseProgram() returned nil")
 	}
@@ -86,8 +276,8 @@ func TestIdentifierExpression(t *testing.T) {
 	l := lexer.New(input)
 	p := New(l)
 
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
 
 	if len(program.Statements) != 1 {
 		t.Fatalf("program.Statements does not contain 1 statement. Got %d", len(program.Statements))
@@ -117,8 +307,8 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	l := lexer.New(input)
 	p := New(l)
 
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
 
 	if len(program.Statements) != 1 {
 		t.Fatalf("program.Statements does not contain 1 statement. Got %d", len(program.Statements))
@@ -143,6 +333,98 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9;", 1e-9},
+		{"2.5E+3;", 2500},
+		{"1_000.5;", 1000.5},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+
+		program, err := p.ParseProgram()
+		checkParserErrors(t, err)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain 1 statement. Got %d", len(program.Statements))
+		}
+
+		stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not an ast.ExpressionStatement. Got %T", program.Statements[0])
+		}
+
+		fl, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("stmt.Expression is not an ast.FloatLiteral. Got %T", stmt.Expression)
+		}
+
+		if fl.Value != tt.expected {
+			t.Errorf("fl.Value not %g. Got %g", tt.expected, fl.Value)
+		}
+	}
+}
+
+func TestIntegerLiteralBases(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF", 255},
+		{"0Xff", 255},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0x_dead_beef", 0xdeadbeef},
+		{"0", 0},
+		{"010", 8},
+		{"0755", 0o755},
+	}
+
+	for _, tt := range tests {
+		program, err := New(lexer.New(tt.input)).ParseProgram()
+		checkParserErrors(t, err)
+
+		literal, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+		if !ok || literal.Value != tt.expected {
+			t.Errorf("wrong literal for %q. want=%d, got=%+v", tt.input, tt.expected, literal)
+		}
+	}
+
+	// Literals too big for an int64 keep their base too
+	program, err := New(lexer.New("0x1_0000_0000_0000_0000")).ParseProgram()
+	checkParserErrors(t, err)
+	literal := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+	if literal.Big == nil || literal.Big.String() != "18446744073709551616" {
+		t.Errorf("wrong big value. got=%v", literal.Big)
+	}
+}
+
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+	l := lexer.New(input)
+	p := New(l)
+
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not an ast.StringLiteral. Got %T", stmt.Expression)
+	}
+
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. Got %q", "hello world", literal.Value)
+	}
+}
+
 func TestBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -156,8 +438,8 @@ func TestBooleanExpression(t *testing.T) {
 		l := lexer.New(tt.input)
 		p := New(l)
 
-		program := p.ParseProgram()
-		checkParserErrors(t, p)
+		program, err := p.ParseProgram()
+		checkParserErrors(t, err)
 
 		if len(program.Statements) != 1 {
 			t.Fatalf("program.Statements does not contain 1 statement. Got %d", len(program.Statements))
@@ -191,14 +473,15 @@ func TestPrefixExpression(t *testing.T) {
 	}{
 		{"!5;", "!", 5},
 		{"-15;", "-", 15},
+		{"~7;", "~", 7},
 	}
 
 	for _, tt := range prefixTests {
 		l := lexer.New(tt.input)
 		p := New(l)
 
-		program := p.ParseProgram()
-		checkParserErrors(t, p)
+		program, err := p.ParseProgram()
+		checkParserErrors(t, err)
 
 		if len(program.Statements) != 1 {
 			t.Fatalf("program.Statements does not contain 1 statement. Got %d", len(program.Statements))
@@ -242,14 +525,25 @@ func TestInfixExpression(t *testing.T) {
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
+		{"true && false", true, "&&", false},
+		{"a || b", "a", "||", "b"},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
 	}
 
 	for _, tt := range infixTests {
 		l := lexer.New(tt.input)
 		p := New(l)
 
-		program := p.ParseProgram()
-		checkParserErrors(t, p)
+		program, err := p.ParseProgram()
+		checkParserErrors(t, err)
 
 		if len(program.Statements) != 1 {
 			t.Fatalf("program.Statements does not contain 1 statement. Got %d", len(program.Statements))
@@ -295,6 +589,25 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		{"2 / (5 + 5)", "(2 / (5 + 5));"},
 		{"-(5 + 5)", "(-(5 + 5));"},
 		{"!(true == true)", "(!(true == true));"},
+		{"a || b && c", "(a || (b && c));"},
+		{"a && b || c", "((a && b) || c);"},
+		{"a && b && c", "((a && b) && c);"},
+		{"a == b && c != d", "((a == b) && (c != d));"},
+		{"a < b || !c", "((a < b) || (!c));"},
+		{"a + 1 && f(b) || -c", "(((a + 1) && f(b)) || (-c));"},
+		{"a <= b == c >= d", "((a <= b) == (c >= d));"},
+		{"a * b % c", "((a * b) % c);"},
+		{"a + b % c", "(a + (b % c));"},
+		{"2 ** 3 ** 2", "(2 ** (3 ** 2));"},
+		{"a * b ** c", "(a * (b ** c));"},
+		{"-2 ** 2", "(-(2 ** 2));"},
+		{"2 ** -1", "(2 ** (-1));"},
+		{"a ** b[0]", "(a ** (b[0]));"},
+		{"a | b ^ c & d", "(a | (b ^ (c & d)));"},
+		{"a & b << c + d", "(a & (b << (c + d)));"},
+		{"a >> 1 < b << 1", "((a >> 1) < (b << 1));"},
+		{"~a & b", "((~a) & b);"},
+		{"a & b == c", "((a & b) == c);"},
 		{
 			"a + add(b * c) + d",
 			"((a + add((b * c))) + d);",
@@ -307,14 +620,22 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g));",
 		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d);",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])));",
+		},
 	}
 
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
 		p := New(l)
 
-		program := p.ParseProgram()
-		checkParserErrors(t, p)
+		program, err := p.ParseProgram()
+		checkParserErrors(t, err)
 
 		actual := program.String()
 		if actual != tt.expected {
@@ -328,8 +649,8 @@ func TestIfExpression(t *testing.T) {
 	l := lexer.New(input)
 	p := New(l)
 
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
 
 	if len(program.Statements) != 1 {
 		t.Fatalf("program.Statements does not contain 1 statement. Got %d", len(program.Statements))
@@ -372,8 +693,8 @@ func TestIfElseExpression(t *testing.T) {
 	l := lexer.New(input)
 	p := New(l)
 
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
 
 	if len(program.Statements) != 1 {
 		t.Fatalf("program.Statements does not contain 1 statement. Got %d", len(program.Statements))
@@ -421,8 +742,8 @@ func TestFunctionLiteral(t *testing.T) {
 	l := lexer.New(input)
 	p := New(l)
 
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
 
 	if len(program.Statements) != 1 {
 		t.Fatalf("program.Statements does not contain 1 statement. Got %d", len(program.Statements))
@@ -471,8 +792,8 @@ func TestFunctionParameterParsing(t *testing.T) {
 		l := lexer.New(tt.input)
 		p := New(l)
 
-		program := p.ParseProgram()
-		checkParserErrors(t, p)
+		program, err := p.ParseProgram()
+		checkParserErrors(t, err)
 
 		stmt := program.Statements[0].(*ast.ExpressionStatement) // Checking the program statement is an expression statement
 		function := stmt.Expression.(*ast.FunctionLiteral)
@@ -492,8 +813,8 @@ func TestCallExpressionParsing(t *testing.T) {
 	l := lexer.New(input)
 	p := New(l)
 
-	program := p.ParseProgram()
-	checkParserErrors(t, p)
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
 
 	if len(program.Statements) != 1 {
 		t.Fatalf("program.Statements does not contain 1 statement. Got %d", len(program.Statements))
@@ -522,14 +843,205 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
 
-func checkParserErrors(t *testing.T, p *Parser) {
-	errors := p.Errors()
-	if len(errors) == 0 {
+func TestArrayLiteralParsing(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+	l := lexer.New(input)
+	p := New(l)
+
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not an ast.ArrayLiteral. Got %T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. Got %d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestEmptyArrayLiteralParsing(t *testing.T) {
+	l := lexer.New("[]")
+	p := New(l)
+
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not an ast.ArrayLiteral. Got %T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) not 0. Got %d", len(array.Elements))
+	}
+}
+
+func TestIndexExpressionParsing(t *testing.T) {
+	input := "myArray[1 + 1]"
+	l := lexer.New(input)
+	p := New(l)
+
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not an ast.IndexExpression. Got %T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
 		return
 	}
-	t.Errorf("parser has %d errors", len(errors))
-	for _, msg := range errors {
-		t.Errorf("parser error: %q", msg)
+
+	testInfixExpression(t, indexExp.Index, 1, "+", 1)
+}
+
+func TestHashLiteralsStringKeys(t *testing.T) {
+	input := `{"one": 1, "two": 2, "three": 3}`
+	l := lexer.New(input)
+	p := New(l)
+
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not an ast.HashLiteral. Got %T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. Got %d", len(hash.Pairs))
+	}
+
+	// Pairs stay in source order
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
+	}
+
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. Got %T", pair.Key)
+			continue
+		}
+		if literal.String() != expected[i].key {
+			t.Errorf("pair %d has the wrong key. want=%q, got=%q", i, expected[i].key, literal.String())
+		}
+
+		testIntegerLiteral(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestHashLiteralsMixedKeys(t *testing.T) {
+	input := `{"a": 1, true: 2, 3: "x"}`
+	l := lexer.New(input)
+	p := New(l)
+
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not an ast.HashLiteral. Got %T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. Got %d", len(hash.Pairs))
+	}
+
+	for _, pair := range hash.Pairs {
+		switch pair.Key.(type) {
+		case *ast.StringLiteral, *ast.Boolean, *ast.IntegerLiteral:
+		default:
+			t.Errorf("unexpected key type %T", pair.Key)
+		}
+	}
+}
+
+func TestEmptyHashLiteral(t *testing.T) {
+	l := lexer.New("{}")
+	p := New(l)
+
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not an ast.HashLiteral. Got %T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 0 {
+		t.Errorf("hash.Pairs has wrong length. Got %d", len(hash.Pairs))
+	}
+}
+
+func TestHashLiteralsWithExpressions(t *testing.T) {
+	input := `{"one": 0 + 1, "two": 10 - 8, "three": 15 / 5}`
+	l := lexer.New(input)
+	p := New(l)
+
+	program, err := p.ParseProgram()
+	checkParserErrors(t, err)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not an ast.HashLiteral. Got %T", stmt.Expression)
+	}
+
+	tests := map[string]func(ast.Expression){
+		"one":   func(e ast.Expression) { testInfixExpression(t, e, 0, "+", 1) },
+		"two":   func(e ast.Expression) { testInfixExpression(t, e, 10, "-", 8) },
+		"three": func(e ast.Expression) { testInfixExpression(t, e, 15, "/", 5) },
+	}
+
+	for _, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. Got %T", pair.Key)
+			continue
+		}
+
+		testFunc, ok := tests[literal.String()]
+		if !ok {
+			t.Errorf("No test function for key %q found", literal.String())
+			continue
+		}
+
+		testFunc(pair.Value)
+	}
+}
+
+func checkParserErrors(t *testing.T, err error) {
+	if err == nil {
+		return
+	}
+
+	var errs ErrorList
+	if !errors.As(err, &errs) {
+		t.Fatalf("ParseProgram() error is not an ErrorList. Got %T", err)
+	}
+
+	t.Errorf("parser has %d errors", len(errs))
+	for _, e := range errs {
+		t.Errorf("parser error: %q", e.Error())
 	}
 }
 
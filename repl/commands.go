@@ -0,0 +1,141 @@
+package repl
+
+import (
+	"fmt"
+	"galexw/monkey/ast"
+	"galexw/monkey/evaluator"
+	"galexw/monkey/object"
+	"os"
+	"strings"
+)
+
+type command struct {
+	Name  string
+	Args  string // shown in :help
+	Help  string
+	Run   func(s *session, arg string)
+	NoArg bool // the command takes no argument
+}
+
+// commands are the colon commands understood at the main prompt, in the
+// order :help lists them. It's filled in by init, as :help refers to it
+var commands []command
+
+func init() {
+	commands = []command{
+		{Name: "env", Help: "list the bindings of the session and their types", Run: (*session).envCommand, NoArg: true},
+		{Name: "type", Args: "expr", Help: "show the type of expr, without keeping its bindings", Run: (*session).typeCommand},
+		{Name: "ast", Args: "expr", Help: "show the syntax tree of expr", Run: (*session).astCommand},
+		{Name: "load", Args: "file.mk", Help: "evaluate a file in the session", Run: (*session).loadCommand},
+		{Name: "save", Args: "file.mk", Help: "write every input evaluated without errors to a file", Run: (*session).saveCommand},
+		{Name: "reset", Help: "forget every binding and the saved inputs", Run: (*session).resetCommand, NoArg: true},
+		{Name: "help", Help: "list the commands", Run: (*session).helpCommand, NoArg: true},
+		{Name: "quit", Help: "leave the REPL", NoArg: true},
+	}
+}
+
+// command runs a line starting with ':' and reports whether the REPL
+// should stop
+func (s *session) command(line string) (quit bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(s.out, "ERROR: internal error: %v\n", r)
+			quit = false
+		}
+	}()
+
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	arg = strings.TrimSpace(arg)
+
+	for _, cmd := range commands {
+		if cmd.Name != name {
+			continue
+		}
+
+		switch {
+		case cmd.NoArg && arg != "":
+			fmt.Fprintf(s.out, ":%s takes no argument\n", cmd.Name)
+		case !cmd.NoArg && arg == "":
+			fmt.Fprintf(s.out, "usage: :%s %s\n", cmd.Name, cmd.Args)
+		case cmd.Run == nil:
+			return true
+		default:
+			cmd.Run(s, arg)
+		}
+		return false
+	}
+
+	fmt.Fprintf(s.out, "unknown command :%s, :help lists the commands\n", name)
+	return false
+}
+
+func (s *session) envCommand(string) {
+	for _, name := range s.env.Names() {
+		obj, _ := s.env.Get(name)
+		if obj == nil {
+			obj = evaluator.NULL
+		}
+		fmt.Fprintf(s.out, "%s: %s\n", name, obj.Type())
+	}
+}
+
+func (s *session) typeCommand(expr string) {
+	program, ok := s.parse("", expr)
+	if !ok {
+		return
+	}
+
+	// Evaluate in a scratch scope so `:type let x = 1` doesn't bind x
+	evaluated := evaluator.Eval(program, object.NewEnclosedEnvironment(s.env))
+	switch evaluated := evaluated.(type) {
+	case nil:
+		fmt.Fprintln(s.out, "no value")
+	case *object.Error:
+		fmt.Fprintln(s.out, evaluated.Inspect())
+	default:
+		fmt.Fprintln(s.out, evaluated.Type())
+	}
+}
+
+func (s *session) astCommand(expr string) {
+	if program, ok := s.parse("", expr); ok {
+		ast.Dump(s.out, program)
+	}
+}
+
+func (s *session) loadCommand(filename string) {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(s.out, "ERROR: %s\n", err)
+		return
+	}
+	s.eval(filename, string(source))
+}
+
+func (s *session) saveCommand(filename string) {
+	var out strings.Builder
+	for _, input := range s.history {
+		out.WriteString(input)
+		out.WriteString(statementEnd(input))
+	}
+
+	if err := os.WriteFile(filename, []byte(out.String()), 0644); err != nil {
+		fmt.Fprintf(s.out, "ERROR: %s\n", err)
+		return
+	}
+	fmt.Fprintf(s.out, "saved %d inputs to %s\n", len(s.history), filename)
+}
+
+func (s *session) resetCommand(string) {
+	*s = *newSession(s.out)
+}
+
+func (s *session) helpCommand(string) {
+	for _, cmd := range commands {
+		usage := ":" + cmd.Name
+		if cmd.Args != "" {
+			usage += " " + cmd.Args
+		}
+		fmt.Fprintf(s.out, "  %-16s %s\n", usage, cmd.Help)
+	}
+}
@@ -0,0 +1,68 @@
+package repl
+
+import (
+	"galexw/monkey/lineedit"
+	"galexw/monkey/object"
+	"galexw/monkey/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// complete returns the keywords, builtins and session bindings starting
+// with word, or the commands when word starts with ':'
+func (s *session) complete(word string) []string {
+	var names []string
+	if strings.HasPrefix(word, ":") {
+		for _, cmd := range commands {
+			names = append(names, ":"+cmd.Name)
+		}
+	} else {
+		names = append(names, token.Keywords()...)
+		for _, builtin := range object.Builtins {
+			names = append(names, builtin.Name)
+		}
+		names = append(names, s.env.Names()...)
+	}
+
+	seen := map[string]bool{}
+	var found []string
+	for _, name := range names {
+		if strings.HasPrefix(name, word) && !seen[name] {
+			seen[name] = true
+			found = append(found, name)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+// historyFile is where the line editor's history is kept between sessions
+func historyFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".monkey_history")
+}
+
+// loadHistory and saveHistory ignore errors: a missing or unwritable
+// history file shouldn't get in the way of the REPL
+func loadHistory(h *lineedit.History) {
+	f, err := os.Open(historyFile())
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	h.Load(f)
+}
+
+func saveHistory(h *lineedit.History) {
+	f, err := os.Create(historyFile())
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	h.Save(f)
+}
@@ -0,0 +1,89 @@
+package repl
+
+import (
+	"galexw/monkey/lexer"
+	"galexw/monkey/token"
+	"strings"
+)
+
+// Tokens that can't end a statement, so input ending with one of them
+// continues on the next line
+var continuationTokens = map[token.TokenType]bool{
+	token.ASSIGN:       true,
+	token.PLUS:         true,
+	token.MINUS:        true,
+	token.BANG:         true,
+	token.TILDE:        true,
+	token.ASTERISK:     true,
+	token.SLASH:        true,
+	token.PERCENT:      true,
+	token.POWER:        true,
+	token.EQUAL:        true,
+	token.NOTEQUAL:     true,
+	token.LESSTHAN:     true,
+	token.GREATERTHAN:  true,
+	token.LESSEQUAL:    true,
+	token.GREATEREQUAL: true,
+	token.AMPERSAND:    true,
+	token.PIPE:         true,
+	token.CARET:        true,
+	token.SHIFTLEFT:    true,
+	token.SHIFTRIGHT:   true,
+	token.AND:          true,
+	token.OR:           true,
+	token.COMMA:        true,
+	token.COLON:        true,
+}
+
+// isComplete reports whether input can be evaluated, or whether the REPL
+// should ask for more lines: it isn't complete while brackets are still
+// open, a string or block comment is unterminated or the last token is an
+// operator. Input with too many closing brackets is complete, the parser
+// reports it
+func isComplete(input string) bool {
+	l := lexer.New(input)
+
+	depth := 0
+	var last token.Token
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LEFTPAREN, token.LEFTBRACE, token.LEFTBRACKET:
+			depth++
+		case token.RIGHTPAREN, token.RIGHTBRACE, token.RIGHTBRACKET:
+			depth--
+		case token.ILLEGAL:
+			// An unterminated string or block comment may end on a later line
+			if strings.HasPrefix(lexer.IllegalReason(tok), "Unterminated") {
+				return false
+			}
+		}
+		last = tok
+	}
+
+	return depth <= 0 && !continuationTokens[last.Type]
+}
+
+// statementEnd is what has to follow input in a file so that the next
+// input starts a new statement. Newlines don't end statements, so input
+// without a final semicolon gets one, on a line of its own after a comment
+func statementEnd(input string) string {
+	l := lexer.New(input)
+	l.KeepComments()
+
+	var last, lastCode token.Token
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		last = tok
+		if tok.Type != token.COMMENT {
+			lastCode = tok
+		}
+	}
+
+	switch {
+	case lastCode.Type == token.SEMICOLON:
+		return "\n"
+	case last.Type == token.COMMENT:
+		return "\n;\n"
+	default:
+		return ";\n"
+	}
+}
@@ -2,49 +2,179 @@ package repl
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"galexw/monkey/ast"
 	"galexw/monkey/evaluator"
 	"galexw/monkey/lexer"
+	"galexw/monkey/lineedit"
 	"galexw/monkey/object"
 	"galexw/monkey/parser"
+	"galexw/monkey/token"
 	"io"
+	"os"
+	"strings"
 )
 
 const PROMPT = `>>> `
 
+// CONTINUATION_PROMPT is shown while the input so far is incomplete
+const CONTINUATION_PROMPT = `... `
+
+// session is the state that lives across inputs
+type session struct {
+	out     io.Writer
+	env     *object.Environment
+	history []string // inputs that evaluated without errors, for :save
+}
+
+func newSession(out io.Writer) *session {
+	return &session{out: out, env: object.NewEnvironment()}
+}
+
+// Start reads input a statement at a time. Lines are collected until they
+// form complete input (see isComplete), then evaluated as one unit. Two
+// empty lines in a row evaluate whatever has been typed, to get out of an
+// unfinished string or a missing bracket. A line starting with ':' at the
+// main prompt is a command, see commands.
+//
+// When in is a terminal lines are read with the line editor, with history
+// kept in ~/.monkey_history and tab completion of names
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	s := newSession(out)
+
+	var lines lineReader = &plainReader{scanner: bufio.NewScanner(in), out: out}
+	if f, ok := in.(*os.File); ok && lineedit.IsTerminal(int(f.Fd())) {
+		editor := lineedit.New(f, out)
+		editor.Complete = s.complete
+		loadHistory(editor.History)
+		defer saveHistory(editor.History)
+		lines = editor
+	}
+
+	var input []string
 	for {
-		fmt.Fprint(out, PROMPT)
-		scanned := scanner.Scan()
+		prompt := PROMPT
+		if len(input) > 0 {
+			prompt = CONTINUATION_PROMPT
+		}
 
-		if !scanned {
+		line, err := lines.ReadLine(prompt)
+		if errors.Is(err, lineedit.ErrInterrupted) {
+			input = nil
+			continue
+		}
+		if err != nil {
+			if len(input) > 0 {
+				s.eval("", strings.Join(input, "\n"))
+			}
 			return
 		}
 
-		line := scanner.Text()
-		lexer := lexer.New(line)
-		parser := parser.New(lexer)
-
-		program := parser.ParseProgram()
+		if len(input) == 0 && strings.TrimSpace(line) == "" {
+			continue
+		}
+		if len(input) == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			if quit := s.command(strings.TrimSpace(line)); quit {
+				return
+			}
+			continue
+		}
+		input = append(input, line)
 
-		if len(parser.Errors()) != 0 {
-			printParserErrors(out, parser.Errors())
+		source := strings.Join(input, "\n")
+		abandoned := len(input) > 2 && line == "" && input[len(input)-2] == ""
+		if !isComplete(source) && !abandoned {
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+		s.eval("", source)
+		input = nil
+	}
+}
+
+// lineReader reads input a line at a time, showing prompt first
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// plainReader reads lines without any editing, for input that isn't a
+// terminal
+type plainReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// eval parses and evaluates one complete piece of input, printing the
+// result, and records it for :save if it succeeded. A panic is reported
+// like any other error so the session keeps going
+func (s *session) eval(filename, input string) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(s.out, "ERROR: internal error: %v\n", r)
 		}
+	}()
+
+	program, ok := s.parse(filename, input)
+	if !ok {
+		return
+	}
+
+	evaluated := evaluator.Eval(program, s.env)
+	if evaluated != nil {
+		io.WriteString(s.out, evaluated.Inspect())
+		io.WriteString(s.out, "\n")
+	}
+
+	if err, ok := evaluated.(*object.Error); ok {
+		printSnippet(s.out, token.Highlight(input, err.Position))
+		return
 	}
+
+	s.history = append(s.history, input)
+}
+
+// parse parses input, printing the errors if there are any
+func (s *session) parse(filename, input string) (*ast.Program, bool) {
+	p := parser.New(lexer.NewFile(filename, input))
+
+	program, err := p.ParseProgram()
+	if err != nil {
+		printParserErrors(s.out, input, err)
+		return nil, false
+	}
+	return program, true
 }
 
 // printParserErrors prints out the parser errors
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+func printParserErrors(out io.Writer, source string, err error) {
+	var errs parser.ErrorList
+	if !errors.As(err, &errs) {
+		io.WriteString(out, "\t"+err.Error()+"\n")
+		return
+	}
+
+	for _, e := range errs {
+		io.WriteString(out, "\t"+strings.ReplaceAll(e.Format(source), "\n", "\n\t")+"\n")
+	}
+}
+
+// printSnippet prints the source line and caret from token.Highlight,
+// indented to match parser errors
+func printSnippet(out io.Writer, snippet string) {
+	if snippet == "" {
+		return
 	}
+	io.WriteString(out, "\t"+strings.ReplaceAll(snippet, "\n", "\n\t")+"\n")
 }
@@ -0,0 +1,263 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsComplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"", true},
+		{"5 + 5", true},
+		{"let add = fn(a, b) {", false},
+		{"let add = fn(a, b) {\n  a + b\n}", true},
+		{"add(1,", false},
+		{"add(1,\n2)", true},
+		{"[1, 2", false},
+		{`{"a": 1`, false},
+		{`{"a":`, false},
+		{"let x =", false},
+		{"1 +", false},
+		{"1 ==", false},
+		{"!", false},
+		{`"abc`, false},
+		{"\"abc\ndef\"", true},
+		{`"a{"`, true},
+		{`"say \"`, false},
+		{`"say \"hi\""`, true},
+		{"`one", false},
+		{"`one\ntwo`", true},
+		{`"a\qb"`, true},
+		{"}", true},
+		{"if (x) { 1 } else {", false},
+		{"1 + // one more\n", false},
+		{"1 // a comment", true},
+		{"/* a /* nested */", false},
+		{"/* a /* nested */ comment */ 1", true},
+	}
+
+	for _, tt := range tests {
+		if got := isComplete(tt.input); got != tt.expected {
+			t.Errorf("isComplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStartMultiLine(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let add = fn(a, b) {\n  a + b\n};\nadd(2, 3)\n",
+			">>> ... ... >>> 5\n>>> ",
+		},
+		{
+			"let s = \"one\ntwo\";\ns\n",
+			">>> ... >>> one\ntwo\n>>> ",
+		},
+		{
+			"1 +\n2\n",
+			">>> ... 3\n>>> ",
+		},
+		{
+			"\n\n1\n",
+			">>> >>> >>> 1\n>>> ",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot =%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestStartAbandonIncompleteInput(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("let x = (1 +\n\n\n5\n"), &out)
+
+	output := out.String()
+	if !strings.Contains(output, "No prefix parse function for token EOF") {
+		t.Errorf("expected a parse error for the abandoned input, got %q", output)
+	}
+	if !strings.HasSuffix(output, ">>> 5\n>>> ") {
+		t.Errorf("expected the REPL to carry on after the abandoned input, got %q", output)
+	}
+}
+
+func TestStartEvaluatesIncompleteInputAtEOF(t *testing.T) {
+	var out bytes.Buffer
+	Start(strings.NewReader("[1, 2"), &out)
+
+	if !strings.Contains(out.String(), "Expected token ]") {
+		t.Errorf("expected a parse error at EOF, got %q", out.String())
+	}
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // substrings of the output, in order
+	}{
+		{
+			"let a = 5;\nlet f = fn(x) { x };\n:env\n",
+			[]string{"a: INTEGER\nf: FUNCTION\n"},
+		},
+		{
+			"let x = fn() {}();\nlet y = if (false) { 1 };\n:env\n",
+			[]string{"x: NULL\ny: NULL\n"},
+		},
+		{
+			":type 1 + 1\n:type \"a\"\n:type let b = 1\n:env\n",
+			[]string{"INTEGER\n", "STRING\n", "no value\n", ">>> >>> "}, // :env lists nothing
+		},
+		{
+			":type x\n",
+			[]string{"ERROR: 1:1: identifier not found: x\n"},
+		},
+		{
+			"let a = 1;\n:reset\na\n",
+			[]string{"identifier not found: a"},
+		},
+		{
+			":ast -1\n",
+			[]string{"Program 1:1\n", "Expression: PrefixExpression 1:1\n", "Value: 1\n"},
+		},
+		{
+			":ast 1 +\n",
+			[]string{"No prefix parse function for token EOF"},
+		},
+		{
+			":nope\n:env extra\n:load\n",
+			[]string{"unknown command :nope", ":env takes no argument", "usage: :load file.mk"},
+		},
+		{
+			":help\n",
+			[]string{":env", ":type expr", ":quit"},
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		output := out.String()
+		for _, want := range tt.expected {
+			i := strings.Index(output, want)
+			if i < 0 {
+				t.Errorf("output for %q is missing %q. got=%q", tt.input, want, out.String())
+				break
+			}
+			output = output[i+len(want):]
+		}
+	}
+
+	// :quit stops reading
+	var out bytes.Buffer
+	Start(strings.NewReader(":quit\n1\n"), &out)
+	if out.String() != ">>> " {
+		t.Errorf("expected :quit to stop the REPL, got %q", out.String())
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "session.mk")
+
+	var out bytes.Buffer
+	input := "let add = fn(a, b) {\n  a + b\n};\nlet x = 1 / 0;\nlet y = ;\nlet z = add(1, 2);\n:save " + file + "\n"
+	Start(strings.NewReader(input), &out)
+
+	if !strings.Contains(out.String(), "saved 2 inputs to "+file) {
+		t.Fatalf("unexpected :save output %q", out.String())
+	}
+
+	saved, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("reading the saved file: %s", err)
+	}
+	expected := "let add = fn(a, b) {\n  a + b\n};\nlet z = add(1, 2);\n"
+	if string(saved) != expected {
+		t.Errorf("saved file wrong.\nwant=%q\ngot =%q", expected, string(saved))
+	}
+
+	out.Reset()
+	Start(strings.NewReader(":load "+file+"\nz\n:load missing.mk\n"), &out)
+	if !strings.Contains(out.String(), ">>> 3\n") {
+		t.Errorf("expected the loaded bindings to be usable, got %q", out.String())
+	}
+	if !strings.Contains(out.String(), "ERROR: open missing.mk") {
+		t.Errorf("expected an error loading a missing file, got %q", out.String())
+	}
+
+	// Inputs without a semicolon mustn't run into the next one when the
+	// file is loaded back
+	file = filepath.Join(t.TempDir(), "statements.mk")
+	check := "[x, f(2), y]\n"
+	out.Reset()
+	Start(strings.NewReader("let x = 5\n-1\nlet f = fn(n) { n * 2 }\nf(2)\n[1, 2]\nlet y = x // five\n"+check+":save "+file+"\n"), &out)
+	original := out.String()
+	if !strings.Contains(original, ">>> [5, 4, 5]\n") {
+		t.Fatalf("unexpected output from the original session %q", original)
+	}
+
+	out.Reset()
+	Start(strings.NewReader(":load "+file+"\n"+check), &out)
+	if !strings.Contains(out.String(), ">>> [5, 4, 5]\n") || strings.Contains(out.String(), "ERROR") {
+		t.Errorf("reloaded session differs from the original one, got %q", out.String())
+	}
+}
+
+func TestStatementEnd(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 5;", "\n"},
+		{"let x = 5", ";\n"},
+		{"fn() {\n  1\n}", ";\n"},
+		{"x; // done", "\n"},
+		{"x // done", "\n;\n"},
+		{"x /* done */", "\n;\n"},
+	}
+
+	for _, tt := range tests {
+		if got := statementEnd(tt.input); got != tt.expected {
+			t.Errorf("statementEnd(%q) wrong. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	s := newSession(&bytes.Buffer{})
+	s.eval("", "let lengths = [1]; let total = 0;")
+
+	tests := []struct {
+		word     string
+		expected []string
+	}{
+		{"le", []string{"len", "lengths", "let"}},
+		{"tot", []string{"total"}},
+		{"tr", []string{"true"}},
+		{"pu", []string{"push", "puts"}},
+		{"zz", nil},
+		{":", []string{":ast", ":env", ":help", ":load", ":quit", ":reset", ":save", ":type"}},
+		{":re", []string{":reset"}},
+	}
+
+	for _, tt := range tests {
+		got := s.complete(tt.word)
+		if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("complete(%q) wrong. want=%v, got=%v", tt.word, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package token
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Position is a location in the source. Line and Column start at 1, Offset
+// is the byte offset into the input and starts at 0. Column counts runes, so
+// it matches what an editor shows for lines with non-ASCII characters
+type Position struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+// IsValid reports whether the position was actually set by the lexer
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	s := p.Filename
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+// Highlight returns the source line that pos points into, followed by a
+// second line with a caret under the column
+func Highlight(source string, pos Position) string {
+	if !pos.IsValid() {
+		return ""
+	}
+
+	lines := strings.Split(source, "\n")
+	if pos.Line > len(lines) {
+		return ""
+	}
+
+	line := strings.TrimRight(lines[pos.Line-1], "\r")
+
+	// Keep tabs in the padding so the caret lines up with the source line,
+	// and pad wide characters with two spaces as terminals draw them
+	var caret strings.Builder
+	for i, ch := range []rune(line) {
+		if i >= pos.Column-1 {
+			break
+		}
+		switch {
+		case ch == '\t':
+			caret.WriteByte('\t')
+		case isWide(ch):
+			caret.WriteString("  ")
+		default:
+			caret.WriteByte(' ')
+		}
+	}
+	caret.WriteByte('^')
+
+	return line + "\n" + caret.String()
+}
+
+// wideRanges are the blocks of East Asian wide and fullwidth characters, and
+// emoji, which take two columns in a terminal
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F},   // Hangul Jamo
+	{0x2E80, 0x303E},   // CJK radicals and punctuation
+	{0x3041, 0x33FF},   // Kana and CJK symbols
+	{0x3400, 0x4DBF},   // CJK extension A
+	{0x4E00, 0x9FFF},   // CJK unified ideographs
+	{0xA000, 0xA4CF},   // Yi
+	{0xAC00, 0xD7A3},   // Hangul syllables
+	{0xF900, 0xFAFF},   // CJK compatibility ideographs
+	{0xFE30, 0xFE4F},   // CJK compatibility forms
+	{0xFF00, 0xFF60},   // Fullwidth forms
+	{0xFFE0, 0xFFE6},   // Fullwidth signs
+	{0x1F300, 0x1F64F}, // Emoji
+	{0x1F900, 0x1F9FF}, // More emoji
+	{0x20000, 0x3FFFD}, // CJK extensions B and later
+}
+
+func isWide(ch rune) bool {
+	for _, r := range wideRanges {
+		if r[0] <= ch && ch <= r[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package token
+
+import "testing"
+
+func TestPositionString(t *testing.T) {
+	tests := []struct {
+		pos      Position
+		expected string
+	}{
+		{Position{}, "-"},
+		{Position{Line: 3, Column: 7}, "3:7"},
+		{Position{Filename: "main.mk", Line: 3, Column: 7}, "main.mk:3:7"},
+		{Position{Filename: "main.mk"}, "main.mk"},
+	}
+
+	for _, tt := range tests {
+		if tt.pos.String() != tt.expected {
+			t.Errorf("Position.String() wrong. expected=%q, got=%q", tt.expected, tt.pos.String())
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	source := "let a = 1;\n\tlet b = a + true;\nlet café = \"☕\";\nlet s = \"日本語\" + 1;"
+
+	tests := []struct {
+		pos      Position
+		expected string
+	}{
+		{Position{Line: 1, Column: 5}, "let a = 1;\n    ^"},
+		{Position{Line: 2, Column: 12}, "\tlet b = a + true;\n\t          ^"},
+		{Position{Line: 3, Column: 11}, "let café = \"☕\";\n          ^"},
+		{Position{Line: 4, Column: 15}, "let s = \"日本語\" + 1;\n                 ^"},
+		{Position{Line: 5, Column: 1}, ""},
+		{Position{}, ""},
+	}
+
+	for _, tt := range tests {
+		actual := Highlight(source, tt.pos)
+		if actual != tt.expected {
+			t.Errorf("Highlight(%s) wrong. expected=%q, got=%q", tt.pos, tt.expected, actual)
+		}
+	}
+}
@@ -1,19 +1,24 @@
 package token
 
+import "sort"
+
 type TokenType string
 
 type Token struct {
-	Type    TokenType
-	Literal string
+	Type     TokenType
+	Literal  string
+	Position Position // Where the first character of the token is
 }
 
 const (
 	ILLEGAL = "Illegal"
 	EOF     = "EOF"
+	COMMENT = "Comment" // only produced when the lexer is asked to keep comments
 
 	// Identifiers + Literals
 	IDENTIFIER = "Identifier" // add, x ,y, ...
 	INT        = "Int"        // 123456
+	FLOAT      = "Float"      // 3.14, 1e-9
 	STRING     = "String"     // "x", "y"
 
 	// Operators
@@ -23,11 +28,26 @@ const (
 	BANG     = "!"
 	ASTERISK = "*"
 	SLASH    = "/"
+	PERCENT  = "%"
+	POWER    = "**"
 	EQUAL    = "=="
 	NOTEQUAL = "!="
 
-	LESSTHAN    = "<"
-	GREATERTHAN = ">"
+	LESSTHAN     = "<"
+	GREATERTHAN  = ">"
+	LESSEQUAL    = "<="
+	GREATEREQUAL = ">="
+
+	AND = "&&"
+	OR  = "||"
+
+	// Bitwise operators
+	AMPERSAND  = "&"
+	PIPE       = "|"
+	CARET      = "^"
+	TILDE      = "~"
+	SHIFTLEFT  = "<<"
+	SHIFTRIGHT = ">>"
 
 	// Delimiters
 	COMMA     = ","
@@ -51,24 +71,30 @@ const (
 	RETURN   = "Return"
 )
 
+var keywords = map[string]TokenType{
+	"fn":     FUNCTION,
+	"let":    LET,
+	"true":   TRUE,
+	"false":  FALSE,
+	"if":     IF,
+	"else":   ELSE,
+	"return": RETURN,
+}
+
 // LookupIdent checks if the given identifier is a keyword and returns the corresponding TokenType.
 func LookupIdent(ident string) TokenType {
-	switch ident {
-	case "fn":
-		return FUNCTION
-	case "let":
-		return LET
-	case "true":
-		return TRUE
-	case "false":
-		return FALSE
-	case "if":
-		return IF
-	case "else":
-		return ELSE
-	case "return":
-		return RETURN
-	default:
-		return IDENTIFIER
+	if tok, ok := keywords[ident]; ok {
+		return tok
+	}
+	return IDENTIFIER
+}
+
+// Keywords lists the words LookupIdent reserves, in sorted order
+func Keywords() []string {
+	words := make([]string, 0, len(keywords))
+	for word := range keywords {
+		words = append(words, word)
 	}
+	sort.Strings(words)
+	return words
 }
@@ -0,0 +1,24 @@
+package token
+
+import "testing"
+
+func TestKeywords(t *testing.T) {
+	words := Keywords()
+
+	expected := []string{"else", "false", "fn", "if", "let", "return", "true"}
+	if len(words) != len(expected) {
+		t.Fatalf("Keywords() wrong. want=%v, got=%v", expected, words)
+	}
+	for i, word := range expected {
+		if words[i] != word {
+			t.Errorf("Keywords()[%d] wrong. want=%q, got=%q", i, word, words[i])
+		}
+		if LookupIdent(word) == IDENTIFIER {
+			t.Errorf("LookupIdent(%q) is not a keyword", word)
+		}
+	}
+
+	if LookupIdent("fnord") != IDENTIFIER {
+		t.Errorf("LookupIdent(%q) wrong. got=%q", "fnord", LookupIdent("fnord"))
+	}
+}
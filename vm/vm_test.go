@@ -0,0 +1,651 @@
+package vm
+
+import (
+	"fmt"
+	"galexw/monkey/ast"
+	"galexw/monkey/compiler"
+	"galexw/monkey/evaluator"
+	"galexw/monkey/lexer"
+	"galexw/monkey/object"
+	"galexw/monkey/parser"
+	"strings"
+	"testing"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"1 + 2", 3},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 * (2 + 10)", 60},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"6 & 3 | 8 ^ 1", 11},
+		{"~5", -6},
+		{"1 << 4 >> 2", 4},
+		{"1 <= 2", true},
+		{"2 >= 3", false},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFloatArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"3.14", 3.14},
+		{"1.5 + 2.25", 3.75},
+		{"1 + 0.5", 1.5},
+		{"10 / 4.0", 2.5},
+		{"-2.5 * 2", -5.0},
+		{"7.5 % 2", 1.5},
+		{"4 ** 0.5", 2.0},
+		{"1 == 1.0", true},
+		{"1.5 < 2", true},
+		{"2.5 >= 2.5", true},
+		{"int(2.9) + float(1)", 3.0},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (1 > 2) { 10 }", Null},
+		{"if (false) { 10 } else { 20 }", 20},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+		{"if (true) { }", Null},
+		{"let x = 1; if (true) { let x = 2; x } + x", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []vmTestCase{
+		{"true && false", false},
+		{"false || true", true},
+		{"1 && 2", 2},
+		{"1 || 2", 1},
+		{"if (false) { 1 } && 3", Null},
+		{"if (false) { 1 } || 3", 3},
+		{"false && 1 / 0", false},
+		{"true || 1 / 0", true},
+		{"false || false || 7", 7},
+		{"let f = fn(x) { x > 0 && x < 10 }; f(5)", true},
+		{"let f = fn(x) { x > 0 || x / 0 }; f(1)", true},
+		{"[1 || 2, 0 && 3][1]", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = fn() { 1; }; one() + one()", 2},
+		{"let noReturn = fn() { }; noReturn();", Null},
+		{"let sum = fn(a, b) { let c = a + b; c; }; sum(1, 2);", 3},
+		{"let early = fn() { return 99; 100; }; early();", 99},
+		{"let returnsOne = fn() { 1; }; let returnsOneReturner = fn() { returnsOne; }; returnsOneReturner()();", 1},
+		{
+			`let wrapper = fn() {
+				let countDown = fn(x) { if (x == 0) { return 0; } else { countDown(x - 1); } };
+				countDown(1);
+			};
+			wrapper();`,
+			0,
+		},
+		{
+			`let newAdderOuter = fn(a, b) {
+				let c = a + b;
+				fn(d) { let e = d + c; fn(f) { e + f; }; };
+			};
+			let newAdderInner = newAdderOuter(1, 2);
+			let adder = newAdderInner(3);
+			adder(8);`,
+			14,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn() { 1; }(1);", "wrong number of arguments: want=0, got=1"},
+		{"let f = fn(a) { a }; f();", "wrong number of arguments: want=1, got=0"},
+		{"1 / 0", "division by zero: 1 / 0"},
+		{"1 % 0", "division by zero: 1 % 0"},
+		{"1 << 10000000000", "integer too large: 1 << 10000000000"},
+		{"2 ** -1", "negative exponent: 2 ** -1"},
+		{"1 << -1", "negative shift count: 1 << -1"},
+		{"~true", "unknown operator: ~BOOLEAN"},
+		{"1.5 / 0", "division by zero: 1.5 / 0.0"},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{"let f = fn(n) { f(n + 1) }; f(0)", "stack overflow"},
+		{"foobar", "identifier not found: foobar"},
+		{"let a = a;", "identifier not found: a"},
+		{"if (true) { let b = 1; }; b", "identifier not found: b"},
+		{"let f = fn() { g() }; f(); let g = fn() { 1 };", "identifier not found: g"},
+	}
+
+	for _, tt := range tests {
+		_, err := run(tt.input)
+		if err == nil {
+			t.Errorf("%q: expected VM error", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("%q: wrong VM error. want=%q, got=%q", tt.input, tt.expected, err)
+		}
+	}
+}
+
+// TestMatchesEvaluator runs the evaluator's test programs through both
+// engines and checks they agree, errors included
+func TestHashOrder(t *testing.T) {
+	result, err := run(`{"b": 1, "a": 2, 3: 3, "b": 4}`)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// Pairs print in the order they were written, like in the evaluator
+	if inspect := result.Inspect(); inspect != "{b: 4, a: 2, 3: 3}" {
+		t.Errorf("Inspect wrong. want=%q, got=%q", "{b: 4, a: 2, 3: 3}", inspect)
+	}
+}
+
+func TestMatchesEvaluator(t *testing.T) {
+	inputs := []string{
+		"5",
+		"10",
+		"-5",
+		"-10",
+		"true",
+		"false",
+		"1 < 2",
+		"1 > 2",
+		"1 < 1",
+		"1 > 1",
+		"1 == 1",
+		"1 != 1",
+		"1 == 2",
+		"1 != 2",
+		"true == true",
+		"false == false",
+		"true == false",
+		"true != false",
+		"false != true",
+		"(1 < 2) == true",
+		"(1 < 2) == false",
+		"(1 > 2) == true",
+		"(1 > 2) == false",
+		"!true",
+		"!false",
+		"!5",
+		"!0",
+		"!!true",
+		"!!false",
+		"!!5",
+		"5 + 5 + 5 + 5 - 10",
+		"2 * 2 * 2 * 2 * 2",
+		"-50 + 100 + -50",
+		"5 * 2 + 10",
+		"5 + 2 * 10",
+		"20 + 2 * -10",
+		"50 / 2 * 2 + 10",
+		"2 * (5 + 10)",
+		"3 * 3 * 3 + 10",
+		"3 * (3 * 3) + 10",
+		"(5 + 10 * 2 + 15 / 3) * 2 + -10",
+		"if (true) { 10 }",
+		"if (false) { 10 }",
+		"if (1) { 10 }",
+		"if (1 < 2) { 10 }",
+		"if (1 > 2) { 10 }",
+		"if (1 > 2) { 10 } else { 20 }",
+		"if (1 < 2) { 10 } else { 20 }",
+		"true && false",
+		"false || true",
+		"1 && 2",
+		"1 || 2",
+		"if (false) { 1 } || 3",
+		"if (false) { 1 } && 3",
+		"false && 1 / 0",
+		"true || 1 / 0",
+		"true && 1 / 0",
+		"1 < 2 && 2 < 3",
+		"false || false || 7",
+		"1 <= 2",
+		"2 <= 2",
+		"3 <= 2",
+		"1 >= 2",
+		"2 >= 2",
+		"1 + 1 >= 2 == true",
+		"7 % 3",
+		"-7 % 3",
+		"1 + 7 % 3 * 2",
+		"2 ** 10",
+		"2 ** 3 ** 2",
+		"-2 ** 2",
+		"(-2) ** 3",
+		"5 ** 0",
+		"6 & 3",
+		"6 | 3",
+		"6 ^ 3",
+		"~5",
+		"1 << 4",
+		"-16 >> 2",
+		"1 >> 70",
+		"1 | 2 ^ 3 & 4 << 1",
+		"-1 << 63",
+		"0xFF + 0o17 + 0b1010",
+		"010 + 0755",
+		"07.5 + 075",
+		"1_000_000 / 1_000",
+		"0x1_0000_0000_0000_0000 - 1",
+		"5 % 0",
+		"9223372036854775807 + 1",
+		"-9223372036854775807 - 2",
+		"4611686018427387904 * 2",
+		"2 ** 63",
+		"2 ** 100",
+		"99999999999999999999",
+		"-99999999999999999999",
+		"99999999999999999999 % 7",
+		"2 ** 64 - 2 ** 64 + 1",
+		"~(2 ** 64)",
+		"2 ** 64 >> 60",
+		"2 ** 64 == 18446744073709551616",
+		"2 ** 64 > 2 ** 63",
+		"2 ** 64 + 0.5",
+		"[1, 2][2 ** 64]",
+		`{2 ** 64: "big"}[18446744073709551616]`,
+		`{2 ** 64: "big"}[-1300789964862373523]`,
+		"let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(25)",
+		"2 ** 10000000000",
+		"2 ** 64 / 0",
+		`int("123456789012345678901234567890")`,
+		"2 ** -1",
+		"1 << 63",
+		"1 << -1",
+		"1 >> -1",
+		"-(-9223372036854775807 - 1)",
+		"~true",
+		"true <= false",
+		`"a" % "b"`,
+		`"a" <= "b"`,
+		"3.14",
+		"1e3",
+		"-1.5",
+		"1.5 + 2.25",
+		"1 + 0.5",
+		"10 / 4.0",
+		"3 * 1.5 - 1",
+		"7.5 % 2",
+		"2 ** 0.5 ** 2",
+		"1 == 1.0",
+		"1.0 != 1",
+		"0.1 + 0.2 == 0.3",
+		"2.5 <= 2.5",
+		"1 < 1.5",
+		"1.5 / 0",
+		"1 % 0.0",
+		"1.5 & 1",
+		"~1.5",
+		"1.5 + true",
+		`"a" * 1.5`,
+		"[1][0.0]",
+		"{1.5: 1}",
+		"int(3.99)",
+		"int(1e19)",
+		"float(3)",
+		`float("abc")`,
+		"str(2.0)",
+		"return 10;",
+		"return 10; 9;",
+		"return 2 * 5; 9;",
+		"9; return 2 * 5; 9;",
+		`
+		if (10 > 1) {
+			if (10 > 1) {
+				return 10;
+			}
+			return 1;
+		}
+		`,
+		"5 + true;",
+		"1 / 0",
+		"let f = fn(x) { 10 / x }; f(5) + f(0)",
+		"5 + true; 5;",
+		"-true",
+		"true + false;",
+		"5; true + false; 5",
+		"if (10 > 1) { true + false; }",
+		`
+		if (10 > 1) {
+			if (10 > 1) {
+				return true + false;
+			}
+			return 1;
+		}
+		`,
+		"foobar",
+		"let f = fn(x) { x }; f(1, 2);",
+		"let f = fn(x, y) { x + y }; f(1);",
+		"5(1);",
+		`"Hello" - "World"`,
+		`"Hello" + 1`,
+		`1 + "Hello"`,
+		`"a" == true`,
+		`[1, 2]["a"]`,
+		`5[0]`,
+		`[1, foobar]`,
+		`{"name": "Monkey"}[fn(x) { x }];`,
+		`{[1]: 2}`,
+		`{"a": foobar}`,
+		"let f = fn(x) { x }; f(foobar);",
+		"let a = 1;\nlet b = -true;",
+		"let f = fn(x) {\n  x + foobar\n};\nf(1)",
+		"len(1)",
+		"let a = 5; a;",
+		"let a = 5 * 5; a;",
+		"let a = 5; let b = a; b;",
+		"let a = 5; let b = a; let c = a + b + 5; c;",
+		"let identity = fn(x) { x; }; identity(5);",
+		"let identity = fn(x) { return x; }; identity(5);",
+		"let double = fn(x) { x * 2; }; double(5);",
+		"let add = fn(x, y) { x + y; }; add(5, 5);",
+		"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));",
+		"fn(x) { x; }(5)",
+		"let f = fn(x) { let y = x * 2; return y; 100 }; f(3) + 1;",
+		`"a" == "a"`,
+		`"a" == "b"`,
+		`"a" != "b"`,
+		`"a" != "a"`,
+		`"ab" == "a" + "b"`,
+		`let s = "x"; s == "x"`,
+		"[1, 2, 3][0]",
+		"[1, 2, 3][1]",
+		"[1, 2, 3][2]",
+		"let i = 0; [1][i];",
+		"[1, 2, 3][1 + 1];",
+		"let myArray = [1, 2, 3]; myArray[2];",
+		"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];",
+		"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]",
+		"[1, 2, 3][3]",
+		"[1, 2, 3][-1]",
+		"[1, 2, 3][-3]",
+		"[1, 2, 3][-4]",
+		"[][0]",
+		"[[1, 2], [3, 4]][1][0]",
+		`{"foo": 5}["foo"]`,
+		`{"foo": 5}["bar"]`,
+		`let key = "foo"; {"foo": 5}[key]`,
+		`{}["foo"]`,
+		`{5: 5}[5]`,
+		`{true: 5}[true]`,
+		`{false: 5}[false]`,
+		`{1: 5}[true]`,
+		`len("")`,
+		`len("four")`,
+		`len("hello world")`,
+		`len([1, 2, 3])`,
+		`len([])`,
+		`len({"a": 1})`,
+		`len(1)`,
+		`len("one", "two")`,
+		`first([1, 2, 3])`,
+		`first([])`,
+		`first(1)`,
+		`last([1, 2, 3])`,
+		`last([])`,
+		`last(1)`,
+		`rest([1, 2, 3])`,
+		`rest([])`,
+		`push([], 1)`,
+		`push(1, 1)`,
+		`push([1])`,
+		`puts("hello", "world!")`,
+		`type(1)`,
+		`type("a")`,
+		`type([])`,
+		`type(len)`,
+		`str(12)`,
+		`str([1, 2])`,
+		`int("42")`,
+		`int(true)`,
+		`int(7)`,
+		`int("abc")`,
+		`int([])`,
+		`let len = fn(x) { 99 }; len("a")`,
+		"let x = 1; if (true) { let x = 2; x }",
+		"let x = 1; if (true) { let x = 2; }; x",
+		"let x = 1; if (true) { x + 1 }",
+		"let x = 1; let f = fn() { let x = 5; if (true) { let x = 10; } x }; f() + x",
+		"let x = 1; let f = fn() { x }; let x = 2; f()",
+		"fn(x) { x + 2; };",
+		`
+	let newAdder = fn(x) {
+		fn(y) { x + y };
+	};
+
+	let addTwo = newAdder(2);
+	addTwo(2);`,
+		`
+	let fib = fn(n) {
+		if (n < 2) { return n; }
+		fib(n - 1) + fib(n - 2)
+	};
+	fib(10);`,
+		`
+	let twice = fn(f, x) { f(f(x)) };
+	let compose = fn(f, g) { fn(x) { g(f(x)) } };
+	let inc = fn(x) { x + 1 };
+	let square = fn(x) { x * x };
+	compose(inc, square)(twice(inc, 1));`,
+		`
+	let x = 1;
+	let f = fn(x) { let y = x; y };
+	f(10);
+	x;`,
+		`"Hello World!"`,
+		`let greet = fn(name) { "Hello" + " " + name + "!" }; greet("World")`,
+		"[1, 2 * 2, 3 + 3]",
+		`let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`,
+		`
+	let map = fn(arr, f) {
+		let iter = fn(arr, accumulated) {
+			if (len(arr) == 0) {
+				accumulated
+			} else {
+				iter(rest(arr), push(accumulated, f(first(arr))));
+			}
+		};
+		iter(arr, []);
+	};
+
+	let reduce = fn(arr, initial, f) {
+		let iter = fn(arr, result) {
+			if (len(arr) == 0) {
+				result
+			} else {
+				iter(rest(arr), f(result, first(arr)));
+			}
+		};
+		iter(arr, initial);
+	};
+
+	let doubled = map([1, 2, 3, 4], fn(x) { x * 2 });
+	reduce(doubled, 0, fn(acc, x) { acc + x });`,
+		`"tab\there" + "\u{1F600}"`,
+		`len("\"\\")`,
+		`{"a\nb": 1}["a\nb"]`,
+		"`raw\\n` == \"raw\\\\n\"",
+		"`line one\nline two`",
+		`len("café 😀")`,
+		`"café"[3]`,
+		`"😀"[-1]`,
+		`"abc"[5]`,
+		`"abc"[1.0]`,
+		`let ñ = "a"; let λ = fn(x) { x + ñ }; λ("b")`,
+		"if (true) {}",
+		"fn() {}()",
+		"fn() { let a = 1; }()",
+		"let y = if (true) {}; y + 1",
+		"let f = fn() {}; [f(), f()]",
+		"let f = fn() { f() }; f()",
+		"let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(500)",
+		// Globals can be used before they are defined, if they are set by
+		// the time the use runs
+		"let f = fn() { g() }; let g = fn() { 7 }; f()",
+		"let f = fn() { g() }; f(); let g = fn() { 7 };",
+		"let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; [even(10), odd(7), even(3)]",
+		"let even = fn(n) { odd(n + 1) }; let odd = fn(n) { even(n + 1) }; even(0)",
+		"let x = y; let y = 1;",
+		"let f = fn() { later }; let later = 1; let later = 2; f()",
+		// Closures see later lets of the variables they capture
+		"fn() { let x = 1; let f = fn() { x }; let x = 2; f() }()",
+		"fn(x) { let f = fn() { fn() { x } }; let x = x * 10; f()() }(4)",
+		"let counter = fn() { let n = 0; let get = fn() { n }; let n = n + 1; [get(), n] }; [counter(), counter()]",
+		"let make = fn(x) { fn() { x } }; let a = make(1); let b = make(2); [a(), b(), a()]",
+		"fn() { let x = 1; if (true) { let x = 2; }; let f = fn() { x }; f() }()",
+		`let odd = fn(n) { "global" }; let o = fn() { let even = fn(n) { odd(n) }; let odd = fn(n) { "local" }; even(1) }; o()`,
+		"let f = fn() { let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } }; let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } }; [even(10), odd(7)] }; f()",
+		"fn() { if (true) { let get = fn() { x }; let x = 3; get() } }()",
+		"fn() { let get = fn() { x }; let y = get(); let x = 1; y }()",
+		"let f = fn() { f }; let g = f; let f = 5; g()",
+		"fn() { let f = fn() { f }; let g = f; let f = 5; g() }()",
+		"fn() { let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) } }; f(3) }()",
+		"{aa: 1, bb: 2, cc: 3}",
+		`{"b": 1 / 0, "a": 2 + true}`,
+		`let h = {"b": 1, "a": 2, "b": 3}; [h["b"], len(h)]`,
+	}
+
+	for _, input := range inputs {
+		program := parse(input)
+		expected := describe(evaluator.Eval(program, object.NewEnvironment()))
+
+		actual, err := run(input)
+		got := describe(actual)
+		if err != nil {
+			got = "ERROR: " + err.Error()
+		}
+
+		if got != expected {
+			t.Errorf("engines disagree on %q\nevaluator=%s\nvm       =%s", input, expected, got)
+		}
+	}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		result, err := run(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+
+		testExpectedObject(t, tt.input, tt.expected, result)
+	}
+}
+
+func run(input string) (object.Object, error) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		return nil, err
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		return nil, err
+	}
+
+	return vm.LastPoppedStackElem(), nil
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	program, _ := p.ParseProgram()
+	return program
+}
+
+func testExpectedObject(t *testing.T, input string, expected interface{}, actual object.Object) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		result, ok := actual.(*object.Integer)
+		if !ok || result.Value != int64(expected) {
+			t.Errorf("%q: expected integer %d, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case float64:
+		result, ok := actual.(*object.Float)
+		if !ok || result.Value != expected {
+			t.Errorf("%q: expected float %g, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case bool:
+		result, ok := actual.(*object.Boolean)
+		if !ok || result.Value != expected {
+			t.Errorf("%q: expected boolean %t, got=%T (%+v)", input, expected, actual, actual)
+		}
+	case *object.Null:
+		if actual != Null {
+			t.Errorf("%q: object is not Null: %T (%+v)", input, actual, actual)
+		}
+	}
+}
+
+// describe renders a result so results from the two engines can be
+// compared. Functions can only be compared by type, and hash pairs are
+// kept in order, so both engines have to agree on it
+func describe(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "nil"
+	case *object.Error:
+		return "ERROR: " + obj.Message
+	case *object.Function, *object.Closure:
+		return "FUNCTION"
+	case *object.Null:
+		return "NULL"
+	case *object.Hash:
+		pairs := []string{}
+		for _, key := range obj.Keys {
+			pair := obj.Pairs[key]
+			pairs = append(pairs, describe(pair.Key)+": "+describe(pair.Value))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *object.Array:
+		elements := []string{}
+		for _, el := range obj.Elements {
+			elements = append(elements, describe(el))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	default:
+		return fmt.Sprintf("%s(%s)", obj.Type(), obj.Inspect())
+	}
+}